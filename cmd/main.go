@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"os"
 
 	"vk-intern/internal/config"
+	"vk-intern/internal/jwt"
+	"vk-intern/internal/kvstore/memory"
 	"vk-intern/internal/kvstore/tarantool"
 	"vk-intern/internal/server"
 	"vk-intern/internal/services/auth"
@@ -17,24 +21,44 @@ const (
 	envProd  = "prod"
 )
 
+const (
+	driverTarantool = "tarantool"
+	driverMemory    = "memory"
+)
+
+type kvStore interface {
+	auth.KVStore
+	storage.KVStore
+
+	Ping(ctx context.Context) error
+	Stop()
+}
+
 func main() {
 	cfg := config.MustLoad()
 	log := newLogger(cfg.Env)
 
 	// kvStore
-	tarantool, err := tarantool.New(&cfg.Tarantool, log)
+	kvStore, err := newKVStore(cfg, log)
+	if err != nil {
+		log.Error("Ошибка подключения хранилища", slog.String("error", err.Error()))
+		panic(err)
+	}
+	defer kvStore.Stop()
+
+	// jwt
+	keys, err := jwt.LoadKeys(&cfg.JWT, cfg.Secret)
 	if err != nil {
-		log.Error("Ошибка подключения Tarantool", slog.String("error", err.Error()))
+		log.Error("Ошибка загрузки ключей подписи", slog.String("error", err.Error()))
 		panic(err)
 	}
-	defer tarantool.Stop()
 
 	// services
-	auth := auth.New(log, tarantool)
-	storage := storage.New(log, tarantool)
+	auth := auth.New(log, kvStore, &cfg.Server.Login)
+	storage := storage.New(log, kvStore)
 
 	// server
-	server := server.New(cfg, log, auth, storage)
+	server := server.New(cfg, log, keys, auth, storage, kvStore)
 
 	if err := server.Run(); err != nil {
 		log.Error("Ошибка при работе сервера", slog.String("error", err.Error()))
@@ -42,6 +66,23 @@ func main() {
 	}
 }
 
+func newKVStore(cfg *config.Config, log *slog.Logger) (kvStore, error) {
+	log.Info("Выбор хранилища", slog.String("driver", cfg.KVStore.Driver))
+
+	switch cfg.KVStore.Driver {
+	case driverTarantool:
+		t, err := tarantool.New(&cfg.Tarantool, log)
+		if err != nil {
+			return nil, err
+		}
+		return t, nil
+	case driverMemory:
+		return memory.New(log), nil
+	default:
+		return nil, fmt.Errorf("неизвестный драйвер хранилища: %s", cfg.KVStore.Driver)
+	}
+}
+
 func newLogger(env string) *slog.Logger {
 	if env == envLocal {
 		return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
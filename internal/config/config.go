@@ -9,18 +9,74 @@ import (
 )
 
 type Config struct {
-	Env    string `yaml:"env" env-default:"local"`
-	Secret string `yaml:"secret" env-required:"true"`
+	Env string `yaml:"env" env-default:"local"`
+	// Секрет HS256. Необязателен, если заданы ключи jwt.keys
+	Secret string `yaml:"secret"`
 
+	JWT       JWTConfig       `yaml:"jwt"`
 	Server    ServerConfig    `yaml:"server"`
+	KVStore   KVStoreConfig   `yaml:"kvstore"`
 	Tarantool TarantoolConfig `yaml:"tarantool"`
 }
 
+type JWTConfig struct {
+	// kid ключа, которым подписываются новые токены. По умолчанию первый ключ
+	SigningKey string         `yaml:"signing-key"`
+	Keys       []JWTKeyConfig `yaml:"keys"`
+}
+
+type JWTKeyConfig struct {
+	ID string `yaml:"kid"`
+	// PEM-файл с закрытым ключом RSA или Ed25519. Для ключей,
+	// которые только проверяют подпись, достаточно открытого ключа
+	Path string `yaml:"path"`
+}
+
 type ServerConfig struct {
 	Host    string        `yaml:"host" env-default:"localhost"`
 	Port    int           `yaml:"port" env-required:"true"`
 	Token   time.Duration `yaml:"token-duration" env-default:"1h"`
+	Refresh time.Duration `yaml:"refresh-token-duration" env-default:"720h"`
 	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+	// Сколько сервер отвечает 503 на /readyz перед остановкой,
+	// чтобы балансировщик успел перестать отправлять запросы
+	ShutdownDelay time.Duration `yaml:"shutdown-delay" env-default:"5s"`
+	// Адреса или подсети (CIDR) балансировщиков и прокси. Для запросов от них
+	// адрес клиента берется из X-Forwarded-For, иначе используется адрес соединения
+	TrustedProxies []string `yaml:"trusted-proxies"`
+
+	Login  LoginConfig  `yaml:"login"`
+	Limits LimitsConfig `yaml:"limits"`
+}
+
+// LimitsConfig - ограничения размера запросов, 0 - без ограничения.
+// Размеры задаются в байтах, размер значения считается по его JSON-представлению.
+type LimitsConfig struct {
+	// Ключей в одном запросе api/read, api/write, api/incr и api/delete
+	MaxKeys      int   `yaml:"max-keys" env-default:"10000"`
+	MaxKeyLength int   `yaml:"max-key-length" env-default:"1024"`
+	MaxValueSize int   `yaml:"max-value-size" env-default:"1048576"`
+	MaxBodySize  int64 `yaml:"max-body-size" env-default:"10485760"`
+}
+
+// LoginConfig - защита входа от подбора пароля.
+// Задержка после неудачной попытки удваивается от base-delay до max-delay,
+// после max-failures неудач вход блокируется на lockout.
+// Для IP-адреса порог выше, так как за ним может быть много пользователей,
+// ip-max-failures: 0 отключает счетчик IP-адреса.
+type LoginConfig struct {
+	MaxFailures   uint64        `yaml:"max-failures" env-default:"5"`
+	IPMaxFailures uint64        `yaml:"ip-max-failures" env-default:"20"`
+	BaseDelay     time.Duration `yaml:"base-delay" env-default:"1s"`
+	MaxDelay      time.Duration `yaml:"max-delay" env-default:"1m"`
+	Lockout       time.Duration `yaml:"lockout" env-default:"15m"`
+	// Счетчик сбрасывается, если за это время не было неудачных попыток
+	Window time.Duration `yaml:"window" env-default:"15m"`
+}
+
+type KVStoreConfig struct {
+	// tarantool или memory
+	Driver string `yaml:"driver" env-default:"tarantool"`
 }
 
 type TarantoolConfig struct {
@@ -31,6 +87,12 @@ type TarantoolConfig struct {
 	Pass string `yaml:"pass" env-required:"true"`
 
 	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+
+	// Сколько запросов одного вызова отправляется без ожидания ответов
+	PipelineWindow int `yaml:"pipeline-window" env-default:"1000"`
+	// Сколько окон запросов могут одновременно ожидать ответа во всех вызовах.
+	// Всего без ответа может быть не больше PipelineWindow * MaxInFlight запросов
+	MaxInFlight int `yaml:"max-inflight" env-default:"16"`
 }
 
 func MustLoad() *Config {
@@ -1,21 +1,56 @@
 package jwt
 
 import (
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func NewToken(name, secret string, duration time.Duration) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+)
+
+var (
+	ErrBadClaims = errors.New("token has invalid claims")
+)
+
+type Claims struct {
+	Username  string
+	Roles     []string
+	ID        string
+	Type      string
+	ExpiresAt time.Time
+}
+
+func NewToken(name string, roles []string, keys *Keys, typ string, duration time.Duration) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+
+	kid, signKey := keys.signing()
+	token := jwt.New(signKey.method)
+	// Токены, подписанные секретом HS256, выдаются без kid, как и раньше
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
 
 	claims := token.Claims.(jwt.MapClaims)
 	claims["name"] = name
+	if len(roles) != 0 {
+		claims["roles"] = roles
+	}
+	// Идентификатор токена нужен для отзыва
+	claims["jti"] = id
+	claims["type"] = typ
 	// Время окончания действия токена надо определить где-то
 	claims["exp"] = time.Now().Add(duration).Unix()
 
-	tokenString, err := token.SignedString([]byte(secret))
+	tokenString, err := token.SignedString(signKey.sign)
 	if err != nil {
 		return "", err
 	}
@@ -23,19 +58,61 @@ func NewToken(name, secret string, duration time.Duration) (string, error) {
 	return tokenString, nil
 }
 
-func ParseJWT(tokenString, secret string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		if t.Method != jwt.SigningMethodHS256 {
-			return nil, fmt.Errorf("method not allowed")
-		}
-		return []byte(secret), nil
-	})
+func ParseJWT(tokenString string, keys *Keys) (*Claims, error) {
+	token, err := jwt.Parse(tokenString, keys.keyFunc)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	claims := token.Claims.(jwt.MapClaims)
-	username := claims["name"].(string)
+	username, _ := claims["name"].(string)
+	id, _ := claims["jti"].(string)
+	typ, _ := claims["type"].(string)
+	roles, err := parseRoles(claims["roles"])
+	if err != nil {
+		return nil, err
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil || username == "" || id == "" || typ == "" {
+		return nil, ErrBadClaims
+	}
+
+	return &Claims{
+		Username:  username,
+		Roles:     roles,
+		ID:        id,
+		Type:      typ,
+		ExpiresAt: exp.Time,
+	}, nil
+}
+
+func parseRoles(claim any) ([]string, error) {
+	if claim == nil {
+		return nil, nil
+	}
+
+	list, ok := claim.([]any)
+	if !ok {
+		return nil, ErrBadClaims
+	}
+
+	roles := make([]string, 0, len(list))
+	for _, r := range list {
+		role, ok := r.(string)
+		if !ok {
+			return nil, ErrBadClaims
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
 
-	return username, nil
+	return hex.EncodeToString(b), nil
 }
@@ -0,0 +1,181 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"vk-intern/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoKeys         = errors.New("не заданы ключи подписи и секрет")
+	ErrUnknownKey     = errors.New("неизвестный kid")
+	ErrNoSigningKey   = errors.New("ключ подписи не найден или не содержит закрытого ключа")
+	ErrUnsupportedKey = errors.New("поддерживаются только ключи RSA и Ed25519")
+)
+
+// key - ключ проверки подписи с алгоритмом, которым он может быть использован
+type key struct {
+	method jwt.SigningMethod
+	// Открытый ключ или секрет HS256
+	verify any
+	// Закрытый ключ, nil для ключей только для проверки
+	sign any
+}
+
+// Keys - набор ключей для подписи и проверки токенов.
+// Токены подписываются одним ключом, проверяются всеми ключами набора,
+// поэтому при ротации старые ключи остаются в наборе, пока не истекут выданные ими токены.
+type Keys struct {
+	signID string
+	keys   map[string]*key
+}
+
+// LoadKeys загружает ключи из PEM-файлов конфигурации.
+// Алгоритм определяется типом ключа: RSA - RS256, Ed25519 - EdDSA.
+// Секрет используется для токенов HS256 без kid: если асимметричные ключи не заданы,
+// токены подписываются им, иначе он нужен только для проверки ранее выданных токенов.
+func LoadKeys(cfg *config.JWTConfig, secret string) (*Keys, error) {
+	k := &Keys{keys: make(map[string]*key)}
+
+	if secret != "" {
+		k.keys[""] = &key{
+			method: jwt.SigningMethodHS256,
+			verify: []byte(secret),
+			sign:   []byte(secret),
+		}
+	}
+
+	for _, kc := range cfg.Keys {
+		pem, err := os.ReadFile(kc.Path)
+		if err != nil {
+			return nil, fmt.Errorf("ключ %s: %w", kc.ID, err)
+		}
+
+		parsed, err := parseKey(pem)
+		if err != nil {
+			return nil, fmt.Errorf("ключ %s: %w", kc.ID, err)
+		}
+		k.keys[kc.ID] = parsed
+	}
+
+	if len(k.keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	k.signID = cfg.SigningKey
+	if len(cfg.Keys) == 0 {
+		k.signID = ""
+	} else if k.signID == "" {
+		k.signID = cfg.Keys[0].ID
+	}
+
+	if signKey, ok := k.keys[k.signID]; !ok || signKey.sign == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoSigningKey, k.signID)
+	}
+
+	return k, nil
+}
+
+func parseKey(pem []byte) (*key, error) {
+	if priv, err := jwt.ParseRSAPrivateKeyFromPEM(pem); err == nil {
+		return &key{method: jwt.SigningMethodRS256, verify: &priv.PublicKey, sign: priv}, nil
+	}
+
+	if priv, err := jwt.ParseEdPrivateKeyFromPEM(pem); err == nil {
+		edPriv, ok := priv.(ed25519.PrivateKey)
+		if !ok {
+			return nil, ErrUnsupportedKey
+		}
+		return &key{method: jwt.SigningMethodEdDSA, verify: edPriv.Public(), sign: edPriv}, nil
+	}
+
+	if pub, err := jwt.ParseRSAPublicKeyFromPEM(pem); err == nil {
+		return &key{method: jwt.SigningMethodRS256, verify: pub}, nil
+	}
+
+	if pub, err := jwt.ParseEdPublicKeyFromPEM(pem); err == nil {
+		return &key{method: jwt.SigningMethodEdDSA, verify: pub}, nil
+	}
+
+	return nil, ErrUnsupportedKey
+}
+
+func (k *Keys) signing() (string, *key) {
+	return k.signID, k.keys[k.signID]
+}
+
+func (k *Keys) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	verifyKey, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	// Алгоритм берется из ключа, а не из заголовка токена
+	if t.Method != verifyKey.method {
+		return nil, fmt.Errorf("method not allowed")
+	}
+	return verifyKey.verify, nil
+}
+
+// JWK - открытый ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// JWKS возвращает открытые ключи набора. Секрет HS256 не публикуется.
+func (k *Keys) JWKS() *JWKS {
+	jwks := &JWKS{Keys: make([]*JWK, 0, len(k.keys))}
+	for kid, verifyKey := range k.keys {
+		if kid == "" {
+			continue
+		}
+
+		if jwk := newJWK(kid, verifyKey); jwk != nil {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+
+	return jwks
+}
+
+func newJWK(kid string, k *key) *JWK {
+	enc := base64.RawURLEncoding
+	jwk := &JWK{Kid: kid, Use: "sig", Alg: k.method.Alg()}
+
+	switch pub := k.verify.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = enc.EncodeToString(pub.N.Bytes())
+		jwk.E = enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = enc.EncodeToString(pub)
+	default:
+		return nil
+	}
+
+	return jwk
+}
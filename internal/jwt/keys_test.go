@@ -0,0 +1,253 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"vk-intern/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKey - сгенерированная пара ключей для тестов
+type testKey struct {
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+func newRSAKey(t *testing.T) *testKey {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testKey{private: priv, public: &priv.PublicKey}
+}
+
+func newEdKey(t *testing.T) *testKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testKey{private: priv, public: pub}
+}
+
+// writePEM сохраняет закрытый или, если public, только открытый ключ и возвращает путь к файлу
+func writePEM(t *testing.T, k *testKey, public bool) string {
+	t.Helper()
+
+	var (
+		block *pem.Block
+		der   []byte
+		err   error
+	)
+	if public {
+		der, err = x509.MarshalPKIXPublicKey(k.public)
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	} else {
+		der, err = x509.MarshalPKCS8PrivateKey(k.private)
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "*.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, block); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func loadTestKeys(t *testing.T, cfg *config.JWTConfig, secret string) *Keys {
+	t.Helper()
+	keys, err := LoadKeys(cfg, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestSignVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		key  *testKey
+		alg  string
+	}{
+		{name: "RSA", key: newRSAKey(t), alg: "RS256"},
+		{name: "Ed25519", key: newEdKey(t), alg: "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		keys := loadTestKeys(t, &config.JWTConfig{
+			Keys: []config.JWTKeyConfig{{ID: "k1", Path: writePEM(t, tt.key, false)}},
+		}, "")
+
+		token, err := NewToken("bob", []string{"reader"}, keys, TypeAccess, time.Minute)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if parsed.Method.Alg() != tt.alg || parsed.Header["kid"] != "k1" {
+			t.Errorf("%s: заголовок %v, want alg %s и kid k1", tt.name, parsed.Header, tt.alg)
+		}
+
+		claims, err := ParseJWT(token, keys)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if claims.Username != "bob" || claims.Type != TypeAccess || claims.ID == "" {
+			t.Errorf("%s: claims %+v", tt.name, claims)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, newKey := newEdKey(t), newRSAKey(t)
+
+	before := loadTestKeys(t, &config.JWTConfig{
+		Keys: []config.JWTKeyConfig{{ID: "old", Path: writePEM(t, oldKey, false)}},
+	}, "")
+	oldToken, err := NewToken("bob", nil, before, TypeAccess, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// После ротации новые токены подписываются новым ключом,
+	// а для старого достаточно открытого ключа
+	after := loadTestKeys(t, &config.JWTConfig{
+		SigningKey: "new",
+		Keys: []config.JWTKeyConfig{
+			{ID: "old", Path: writePEM(t, oldKey, true)},
+			{ID: "new", Path: writePEM(t, newKey, false)},
+		},
+	}, "")
+
+	if _, err := ParseJWT(oldToken, after); err != nil {
+		t.Errorf("токен старого ключа: %v", err)
+	}
+
+	newToken, err := NewToken("bob", nil, after, TypeAccess, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseJWT(newToken, after); err != nil {
+		t.Errorf("токен нового ключа: %v", err)
+	}
+	if _, err := ParseJWT(newToken, before); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("токен с неизвестным kid: ошибка %v, want %v", err, ErrUnknownKey)
+	}
+
+	_, err = LoadKeys(&config.JWTConfig{
+		SigningKey: "old",
+		Keys:       []config.JWTKeyConfig{{ID: "old", Path: writePEM(t, oldKey, true)}},
+	}, "")
+	if !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("подпись открытым ключом: ошибка %v, want %v", err, ErrNoSigningKey)
+	}
+}
+
+func TestAlgorithmPinning(t *testing.T) {
+	rsaKey := newRSAKey(t)
+	path := writePEM(t, rsaKey, false)
+	keys := loadTestKeys(t, &config.JWTConfig{
+		Keys: []config.JWTKeyConfig{{ID: "k1", Path: path}},
+	}, "")
+
+	pubDER, err := x509.MarshalPKIXPublicKey(rsaKey.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	claims := jwt.MapClaims{
+		"name": "bob",
+		"jti":  "forged",
+		"type": TypeAccess,
+		"exp":  time.Now().Add(time.Minute).Unix(),
+	}
+
+	// Открытый ключ известен всем, поэтому токен HS256, подписанный им как секретом,
+	// не должен проходить проверку
+	for _, secret := range [][]byte{pubPEM, pubDER} {
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		forged.Header["kid"] = "k1"
+		token, err := forged.SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ParseJWT(token, keys); err == nil {
+			t.Error("принят токен HS256, подписанный открытым ключом RSA")
+		}
+	}
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	unsigned.Header["kid"] = "k1"
+	token, err := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseJWT(token, keys); err == nil {
+		t.Error("принят токен без подписи")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, edKey := newRSAKey(t), newEdKey(t)
+	keys := loadTestKeys(t, &config.JWTConfig{
+		Keys: []config.JWTKeyConfig{
+			{ID: "rsa", Path: writePEM(t, rsaKey, false)},
+			{ID: "ed", Path: writePEM(t, edKey, true)},
+		},
+	}, "secret")
+
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("ключей %d, want 2 без секрета HS256", len(jwks.Keys))
+	}
+
+	enc := base64.RawURLEncoding
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "sig" {
+			t.Errorf("%s: use %q, want sig", jwk.Kid, jwk.Use)
+		}
+
+		switch jwk.Kid {
+		case "rsa":
+			pub := rsaKey.public.(*rsa.PublicKey)
+			n, _ := enc.DecodeString(jwk.N)
+			e, _ := enc.DecodeString(jwk.E)
+			if jwk.Kty != "RSA" || jwk.Alg != "RS256" ||
+				new(big.Int).SetBytes(n).Cmp(pub.N) != 0 || new(big.Int).SetBytes(e).Int64() != int64(pub.E) {
+				t.Errorf("ключ RSA %+v не совпадает с открытым ключом", jwk)
+			}
+		case "ed":
+			x, _ := enc.DecodeString(jwk.X)
+			if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || jwk.Alg != "EdDSA" ||
+				!ed25519.PublicKey(x).Equal(edKey.public) {
+				t.Errorf("ключ Ed25519 %+v не совпадает с открытым ключом", jwk)
+			}
+		default:
+			t.Errorf("неизвестный kid %q", jwk.Kid)
+		}
+	}
+}
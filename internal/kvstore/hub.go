@@ -0,0 +1,91 @@
+package kvstore
+
+import (
+	"context"
+	"sync"
+
+	"vk-intern/internal/models"
+)
+
+// Размер буфера подписчика. Подписчик, который не успевает
+// читать события, отключается, чтобы не задерживать остальных.
+const subscriberBuffer = 256
+
+// Hub рассылает события изменения ключей подписчикам
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[chan *models.Event]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[chan *models.Event]struct{})}
+}
+
+// Subscribe возвращает канал событий, который закрывается
+// после завершения ctx, остановки хранилища, переполнения буфера или потери событий
+func (h *Hub) Subscribe(ctx context.Context) <-chan *models.Event {
+	ch := make(chan *models.Event, subscriberBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(ch)
+		return ch
+	}
+	h.subs[ch] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+		h.mu.Lock()
+		h.remove(ch)
+		h.mu.Unlock()
+	}()
+
+	return ch
+}
+
+// Publish отправляет событие всем подписчикам без ожидания
+func (h *Hub) Publish(event *models.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs {
+		select {
+		case ch <- event:
+		default:
+			h.remove(ch)
+		}
+	}
+}
+
+// Reset отключает всех подписчиков, но принимает новые.
+// Вызывается, когда часть событий потеряна и подписчикам нужно перечитать ключи.
+func (h *Hub) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs {
+		h.remove(ch)
+	}
+}
+
+// Close отключает всех подписчиков
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for ch := range h.subs {
+		h.remove(ch)
+	}
+}
+
+// remove вызывается под мьютексом
+func (h *Hub) remove(ch chan *models.Event) {
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
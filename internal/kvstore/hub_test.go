@@ -0,0 +1,120 @@
+package kvstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"vk-intern/internal/models"
+)
+
+// waitClosed проверяет, что канал закрыт, вычитывая оставшиеся события
+func waitClosed(t *testing.T, ch <-chan *models.Event) int {
+	t.Helper()
+
+	timeout := time.After(time.Second)
+	n := 0
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return n
+			}
+			n++
+		case <-timeout:
+			t.Fatal("канал подписчика не закрыт")
+		}
+	}
+}
+
+func TestHubPublish(t *testing.T) {
+	h := NewHub()
+	defer h.Close()
+
+	a := h.Subscribe(context.Background())
+	b := h.Subscribe(context.Background())
+
+	event := &models.Event{Key: "k", Value: 1, Version: 1, Op: models.EventPut}
+	h.Publish(event)
+
+	for _, ch := range []<-chan *models.Event{a, b} {
+		select {
+		case got := <-ch:
+			if got != event {
+				t.Errorf("получено событие %+v, want %+v", got, event)
+			}
+		default:
+			t.Error("подписчик не получил событие")
+		}
+	}
+}
+
+func TestHubOverflow(t *testing.T) {
+	h := NewHub()
+	defer h.Close()
+
+	slow := h.Subscribe(context.Background())
+	for i := range subscriberBuffer + 1 {
+		h.Publish(&models.Event{Key: "k", Version: uint64(i + 1), Op: models.EventPut})
+	}
+
+	// Подписчик, который не успевает читать, отключается после заполнения буфера
+	if n := waitClosed(t, slow); n != subscriberBuffer {
+		t.Errorf("получено %d событий до отключения, want %d", n, subscriberBuffer)
+	}
+
+	// Новые подписчики продолжают получать события
+	fresh := h.Subscribe(context.Background())
+	h.Publish(&models.Event{Key: "k", Op: models.EventDelete})
+	select {
+	case <-fresh:
+	default:
+		t.Error("новый подписчик не получил событие")
+	}
+}
+
+func TestHubReset(t *testing.T) {
+	h := NewHub()
+	defer h.Close()
+
+	ch := h.Subscribe(context.Background())
+	h.Reset()
+	waitClosed(t, ch)
+
+	// В отличие от Close, после Reset можно подписаться заново
+	fresh := h.Subscribe(context.Background())
+	h.Publish(&models.Event{Key: "k", Op: models.EventPut})
+	select {
+	case <-fresh:
+	default:
+		t.Error("подписчик после Reset не получил событие")
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	h := NewHub()
+
+	ch := h.Subscribe(context.Background())
+	h.Close()
+	waitClosed(t, ch)
+
+	// После Close подписка сразу возвращает закрытый канал
+	waitClosed(t, h.Subscribe(context.Background()))
+
+	// Повторный Close и Publish после закрытия не паникуют
+	h.Close()
+	h.Publish(&models.Event{Key: "k"})
+}
+
+func TestHubContextDone(t *testing.T) {
+	h := NewHub()
+	defer h.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := h.Subscribe(ctx)
+	cancel()
+	waitClosed(t, ch)
+
+	// Отписанный канал уже закрыт, Publish не должен в него писать
+	h.Publish(&models.Event{Key: "k"})
+}
@@ -2,10 +2,63 @@ package kvstore
 
 import (
 	"errors"
+	"time"
+
+	"vk-intern/internal/models"
 )
 
 var (
-	ErrUserNotFound = errors.New("Пользователь не найден")
-	ErrDataNotFound = errors.New("Данные по ключу не найдены")
-	ErrKeyNotFound  = errors.New("Ключи не найдены")
+	ErrUserNotFound   = errors.New("Пользователь не найден")
+	ErrUserExists     = errors.New("Пользователь уже существует")
+	ErrGrantNotFound  = errors.New("Правило доступа не найдено")
+	ErrAPIKeyNotFound = errors.New("API-ключ не найден")
+	ErrDataNotFound   = errors.New("Данные по ключу не найдены")
+	ErrKeyNotFound    = errors.New("Ключи не найдены")
+	ErrRolledBack     = errors.New("Транзакция отменена")
+
+	ErrVersionConflict  = errors.New("Версия ключа изменилась")
+	ErrWatchUnavailable = errors.New("Подписка на изменения недоступна")
+	ErrNotNumeric       = errors.New("Значение ключа не является числом")
+	ErrNotConnected     = errors.New("Нет соединения с хранилищем")
 )
+
+// ExpiresAt возвращает unix-время (в секундах), когда истечет ключ
+// с временем жизни ttl. Для ttl <= 0 возвращается 0, то есть ключ бессрочный.
+func ExpiresAt(ttl time.Duration) uint64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	// Округление вверх, чтобы ключ не истек раньше срока
+	return uint64(time.Now().Add(ttl + time.Second - 1).Unix())
+}
+
+// Expired проверяет, истек ли ключ к текущему моменту
+func Expired(expiresAt uint64) bool {
+	return expiresAt != 0 && expiresAt <= uint64(time.Now().Unix())
+}
+
+// LockedUntil возвращает unix-время, до которого заблокирован вход
+// после failures неудачных попыток подряд. Такой же расчет выполняет
+// kv_login_failed в tarantInit.lua.
+func LockedUntil(failures, now uint64, policy *models.LockoutPolicy) uint64 {
+	if failures >= policy.MaxFailures {
+		return now + Seconds(policy.Lockout)
+	}
+
+	delay := Seconds(policy.BaseDelay)
+	for i := uint64(1); i < failures && delay < Seconds(policy.MaxDelay); i++ {
+		delay *= 2
+	}
+
+	return now + min(delay, Seconds(policy.MaxDelay))
+}
+
+// Seconds переводит длительность в целые секунды с округлением вверх
+func Seconds(d time.Duration) uint64 {
+	if d <= 0 {
+		return 0
+	}
+
+	return uint64((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,76 @@
+package kvstore
+
+import (
+	"testing"
+	"time"
+
+	"vk-intern/internal/models"
+)
+
+func TestExpired(t *testing.T) {
+	now := uint64(time.Now().Unix())
+
+	tests := []struct {
+		name      string
+		expiresAt uint64
+		want      bool
+	}{
+		{name: "бессрочный", expiresAt: 0, want: false},
+		{name: "истек", expiresAt: now - 1, want: true},
+		{name: "не истек", expiresAt: now + 60, want: false},
+		{name: "истекает в текущую секунду", expiresAt: now, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := Expired(tt.expiresAt); got != tt.want {
+			t.Errorf("%s: Expired(%d) = %v, want %v", tt.name, tt.expiresAt, got, tt.want)
+		}
+	}
+}
+
+func TestLockedUntil(t *testing.T) {
+	const now = 1_000_000
+	policy := &models.LockoutPolicy{
+		MaxFailures: 5,
+		BaseDelay:   time.Second,
+		MaxDelay:    10 * time.Second,
+		Lockout:     15 * time.Minute,
+	}
+
+	tests := []struct {
+		failures uint64
+		want     uint64
+	}{
+		{failures: 1, want: now + 1},
+		{failures: 2, want: now + 2},
+		{failures: 3, want: now + 4},
+		{failures: 4, want: now + 8},
+		{failures: 5, want: now + 15*60},
+		{failures: 6, want: now + 15*60},
+	}
+
+	for _, tt := range tests {
+		if got := LockedUntil(tt.failures, now, policy); got != tt.want {
+			t.Errorf("LockedUntil(%d) = %d, want %d", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestSeconds(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want uint64
+	}{
+		{d: -time.Second, want: 0},
+		{d: 0, want: 0},
+		{d: time.Millisecond, want: 1},
+		{d: time.Second, want: 1},
+		{d: 1500 * time.Millisecond, want: 2},
+	}
+
+	for _, tt := range tests {
+		if got := Seconds(tt.d); got != tt.want {
+			t.Errorf("Seconds(%v) = %d, want %d", tt.d, got, tt.want)
+		}
+	}
+}
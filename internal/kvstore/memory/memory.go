@@ -0,0 +1,888 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"vk-intern/internal/kvstore"
+	"vk-intern/internal/models"
+)
+
+const (
+	// Период удаления истекших ключей
+	sweepInterval = time.Second
+
+	// bcrypt-хеш пароля presale
+	adminPassword = "$2a$10$UAmBy5uEOjJ1Ci52C3N5xOLS6eYfYmLdaDM.l9QjyrET/aIwIWkGC"
+)
+
+type entry struct {
+	value     any
+	expiresAt uint64
+	version   uint64
+}
+
+// attempts - счетчик неудачных попыток входа
+type attempts struct {
+	failures    uint64
+	lockedUntil uint64
+	expiresAt   uint64
+}
+
+type Memory struct {
+	log *slog.Logger
+
+	mu      sync.RWMutex
+	users   map[string]*models.User
+	storage map[string]*entry
+	// Отозванные токены и время их истечения
+	revoked map[string]uint64
+	// Правила доступа по субъекту и префиксу
+	grants map[[2]string]*models.Grant
+	// API-ключи по идентификатору
+	apiKeys map[string]*models.APIKey
+	// Неудачные попытки входа по субъекту
+	attempts map[string]*attempts
+	// Последняя выданная версия. Версии общие для всех ключей, поэтому
+	// ключ, созданный заново после удаления, не получает прежнюю версию
+	version uint64
+
+	hub  *kvstore.Hub
+	done chan struct{}
+}
+
+func New(logger *slog.Logger) *Memory {
+	const op = "memory.New"
+	log := logger.With(slog.String("op", op))
+
+	// Такой же пользователь, как и в tarantInit.lua
+	users := map[string]*models.User{
+		"admin": {Username: "admin", Password: adminPassword, Roles: []string{models.RoleAdmin}},
+	}
+
+	m := &Memory{
+		log: logger,
+
+		users:    users,
+		storage:  make(map[string]*entry),
+		revoked:  make(map[string]uint64),
+		grants:   make(map[[2]string]*models.Grant),
+		apiKeys:  make(map[string]*models.APIKey),
+		attempts: make(map[string]*attempts),
+
+		hub:  kvstore.NewHub(),
+		done: make(chan struct{}),
+	}
+	// Такие же правила доступа по умолчанию, как и в tarantInit.lua
+	for _, grant := range []*models.Grant{
+		{Subject: models.RoleSubject(models.RoleReader), Read: true},
+		{Subject: models.RoleSubject(models.RoleWriter), Read: true, Write: true},
+	} {
+		m.grants[[2]string{grant.Subject, grant.Prefix}] = grant
+	}
+
+	go m.sweeper()
+
+	log.Info("Хранилище в памяти создано")
+	return m
+}
+
+func (m *Memory) Stop() {
+	close(m.done)
+	m.hub.Close()
+}
+
+// Ping всегда успешен, хранилище находится в памяти процесса
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Subscribe возвращает канал событий изменения ключей
+func (m *Memory) Subscribe(ctx context.Context) (<-chan *models.Event, error) {
+	return m.hub.Subscribe(ctx), nil
+}
+
+// sweeper периодически удаляет истекшие ключи
+func (m *Memory) sweeper() {
+	const op = "memory.sweeper"
+	log := m.log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			expired := 0
+			for k, e := range m.storage {
+				if kvstore.Expired(e.expiresAt) {
+					delete(m.storage, k)
+					m.hub.Publish(&models.Event{Key: k, Version: e.version, Op: models.EventDelete})
+					expired++
+				}
+			}
+			for id, expiresAt := range m.revoked {
+				if kvstore.Expired(expiresAt) {
+					delete(m.revoked, id)
+				}
+			}
+			for subject, a := range m.attempts {
+				if kvstore.Expired(a.expiresAt) {
+					delete(m.attempts, subject)
+				}
+			}
+			m.mu.Unlock()
+
+			if expired > 0 {
+				log.Info("Истекшие ключи удалены", slog.Int("expired", expired))
+			}
+		}
+	}
+}
+
+func (m *Memory) GetUser(ctx context.Context, username string) (*models.User, error) {
+	const op = "memory.GetUser"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	log.Info("Получение пользователя")
+	user, ok := m.users[username]
+	if !ok {
+		log.Error("Пользователь не найден")
+		return nil, fmt.Errorf("%s: %w", op, kvstore.ErrUserNotFound)
+	}
+
+	// Копия, чтобы вызывающий не мог изменить хранилище
+	u := *user
+	u.Roles = slices.Clone(user.Roles)
+	return &u, nil
+}
+
+func (m *Memory) CreateUser(ctx context.Context, user *models.User) error {
+	const op = "memory.CreateUser"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[user.Username]; ok {
+		log.Error("Пользователь уже существует")
+		return fmt.Errorf("%s: %w", op, kvstore.ErrUserExists)
+	}
+
+	u := *user
+	u.Roles = slices.Clone(user.Roles)
+	m.users[user.Username] = &u
+	log.Info("Пользователь создан")
+	return nil
+}
+
+func (m *Memory) ListUsers(ctx context.Context) ([]*models.User, error) {
+	const op = "memory.ListUsers"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]*models.User, 0, len(m.users))
+	for _, user := range m.users {
+		u := *user
+		u.Roles = slices.Clone(user.Roles)
+		users = append(users, &u)
+	}
+
+	// Порядок как у первичного индекса в Tarantool
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	log.Info("Пользователи получены", slog.Int("count", len(users)))
+	return users, nil
+}
+
+func (m *Memory) UpdateUser(ctx context.Context, user *models.User) error {
+	const op = "memory.UpdateUser"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[user.Username]
+	if !ok {
+		log.Error("Пользователь не найден")
+		return fmt.Errorf("%s: %w", op, kvstore.ErrUserNotFound)
+	}
+
+	// Обновляются только заданные поля
+	if user.Password != "" {
+		stored.Password = user.Password
+	}
+	if user.Roles != nil {
+		stored.Roles = slices.Clone(user.Roles)
+	}
+	log.Info("Пользователь обновлен")
+	return nil
+}
+
+// DeleteUser удаляет пользователя вместе с его API-ключами и правилами доступа
+func (m *Memory) DeleteUser(ctx context.Context, username string) error {
+	const op = "memory.DeleteUser"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[username]; !ok {
+		log.Error("Пользователь не найден")
+		return fmt.Errorf("%s: %w", op, kvstore.ErrUserNotFound)
+	}
+
+	delete(m.users, username)
+	for id, key := range m.apiKeys {
+		if key.Username == username {
+			delete(m.apiKeys, id)
+		}
+	}
+	subject := models.UserSubject(username)
+	for k := range m.grants {
+		if k[0] == subject {
+			delete(m.grants, k)
+		}
+	}
+	log.Info("Пользователь удален")
+	return nil
+}
+
+func (m *Memory) ListGrants(ctx context.Context, subjects []string) ([]*models.Grant, error) {
+	const op = "memory.ListGrants"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	grants := make([]*models.Grant, 0)
+	for _, grant := range m.grants {
+		if subjects == nil || slices.Contains(subjects, grant.Subject) {
+			g := *grant
+			grants = append(grants, &g)
+		}
+	}
+
+	// Порядок как у первичного индекса в Tarantool
+	sort.Slice(grants, func(i, j int) bool {
+		if grants[i].Subject != grants[j].Subject {
+			return grants[i].Subject < grants[j].Subject
+		}
+		return grants[i].Prefix < grants[j].Prefix
+	})
+
+	log.Info("Правила доступа получены", slog.Int("count", len(grants)))
+	return grants, nil
+}
+
+func (m *Memory) PutGrant(ctx context.Context, grant *models.Grant) error {
+	const op = "memory.PutGrant"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g := *grant
+	m.grants[[2]string{grant.Subject, grant.Prefix}] = &g
+	log.Info("Правило доступа сохранено")
+	return nil
+}
+
+func (m *Memory) DeleteGrant(ctx context.Context, subject, prefix string) error {
+	const op = "memory.DeleteGrant"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := [2]string{subject, prefix}
+	if _, ok := m.grants[key]; !ok {
+		log.Error("Правило доступа не найдено")
+		return fmt.Errorf("%s: %w", op, kvstore.ErrGrantNotFound)
+	}
+
+	delete(m.grants, key)
+	log.Info("Правило доступа удалено")
+	return nil
+}
+
+func (m *Memory) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	const op = "memory.CreateAPIKey"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := *key
+	k.Roles = slices.Clone(key.Roles)
+	m.apiKeys[key.ID] = &k
+	log.Info("API-ключ создан")
+	return nil
+}
+
+func (m *Memory) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	const op = "memory.GetAPIKey"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, ok := m.apiKeys[id]
+	if !ok {
+		log.Error("API-ключ не найден")
+		return nil, fmt.Errorf("%s: %w", op, kvstore.ErrAPIKeyNotFound)
+	}
+
+	k := *key
+	k.Roles = slices.Clone(key.Roles)
+	return &k, nil
+}
+
+func (m *Memory) ListAPIKeys(ctx context.Context, username string) ([]*models.APIKey, error) {
+	const op = "memory.ListAPIKeys"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]*models.APIKey, 0)
+	for _, key := range m.apiKeys {
+		if username == "" || key.Username == username {
+			k := *key
+			k.Roles = slices.Clone(key.Roles)
+			keys = append(keys, &k)
+		}
+	}
+
+	// Порядок как у первичного индекса в Tarantool
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+
+	log.Info("API-ключи получены", slog.Int("count", len(keys)))
+	return keys, nil
+}
+
+func (m *Memory) TouchAPIKey(ctx context.Context, id string, usedAt uint64) error {
+	const op = "memory.TouchAPIKey"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if key, ok := m.apiKeys[id]; ok {
+		key.LastUsed = usedAt
+	}
+	return nil
+}
+
+func (m *Memory) DeleteAPIKey(ctx context.Context, id string) error {
+	const op = "memory.DeleteAPIKey"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.apiKeys[id]; !ok {
+		log.Error("API-ключ не найден")
+		return fmt.Errorf("%s: %w", op, kvstore.ErrAPIKeyNotFound)
+	}
+
+	delete(m.apiKeys, id)
+	log.Info("API-ключ удален")
+	return nil
+}
+
+func (m *Memory) RevokeToken(ctx context.Context, id string, expiresAt uint64) error {
+	const op = "memory.RevokeToken"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.revoked[id] = expiresAt
+	log.Info("Токен отозван", slog.String("jti", id))
+	return nil
+}
+
+func (m *Memory) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	const op = "memory.IsTokenRevoked"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.revoked[id]
+	return ok, nil
+}
+
+func (m *Memory) LoginFailed(ctx context.Context,
+	subject string, policy *models.LockoutPolicy,
+) (uint64, error) {
+	const op = "memory.LoginFailed"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	failures := uint64(1)
+	if a, ok := m.attempts[subject]; ok && !kvstore.Expired(a.expiresAt) {
+		failures = a.failures + 1
+	}
+
+	now := uint64(time.Now().Unix())
+	lockedUntil := kvstore.LockedUntil(failures, now, policy)
+	m.attempts[subject] = &attempts{
+		failures:    failures,
+		lockedUntil: lockedUntil,
+		expiresAt:   max(now+kvstore.Seconds(policy.Window), lockedUntil),
+	}
+
+	log.Info("Неудачная попытка входа учтена",
+		slog.String("subject", subject), slog.Uint64("failures", failures))
+	return lockedUntil, nil
+}
+
+func (m *Memory) LoginLockedUntil(ctx context.Context, subjects []string) (uint64, error) {
+	const op = "memory.LoginLockedUntil"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var lockedUntil uint64
+	for _, subject := range subjects {
+		if a, ok := m.attempts[subject]; ok && !kvstore.Expired(a.expiresAt) {
+			lockedUntil = max(lockedUntil, a.lockedUntil)
+		}
+	}
+
+	return lockedUntil, nil
+}
+
+func (m *Memory) ResetLoginFailures(ctx context.Context, subject string) error {
+	const op = "memory.ResetLoginFailures"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, subject)
+	return nil
+}
+
+// Write записывает пары независимо друг от друга, как и Tarantool.
+// Ключи, версия которых не совпала с ожидаемой, не записываются и возвращаются с ошибкой.
+func (m *Memory) Write(ctx context.Context,
+	data models.Data, ttl models.TTL, expected models.Versions,
+) (models.Versions, map[string]error, error) {
+	const op = "memory.Write"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	versions := make(models.Versions, len(data))
+	failed := make(map[string]error)
+	for k, v := range data {
+		if version, ok := expected[k]; ok && m.current(k) != version {
+			log.Error("Версия ключа изменилась", slog.String("key", k))
+			failed[k] = fmt.Errorf("%s: %w: %s", op, kvstore.ErrVersionConflict, k)
+			continue
+		}
+
+		versions[k] = m.put(k, v, ttl[k])
+	}
+
+	log.Info("Данные записаны в память", slog.Int("written", len(versions)))
+	return versions, failed, nil
+}
+
+// current возвращает текущую версию ключа, 0 - ключ не существует.
+// Вызывается под мьютексом.
+func (m *Memory) current(key string) uint64 {
+	e, ok := m.storage[key]
+	if !ok || kvstore.Expired(e.expiresAt) {
+		return 0
+	}
+
+	return e.version
+}
+
+// put записывает пару с увеличением версии и возвращает новую версию.
+// Вызывается под мьютексом.
+func (m *Memory) put(key string, value any, ttl time.Duration) uint64 {
+	version := m.nextVersion()
+	m.storage[key] = &entry{value: value, expiresAt: kvstore.ExpiresAt(ttl), version: version}
+	m.hub.Publish(&models.Event{Key: key, Value: value, Version: version, Op: models.EventPut})
+	return version
+}
+
+// nextVersion возвращает следующую версию. Вызывается под мьютексом.
+func (m *Memory) nextVersion() uint64 {
+	m.version++
+	return m.version
+}
+
+// WriteAtomic записывает все пары под мьютексом. Сначала проверяются
+// все ожидаемые версии, чтобы при конфликте ничего не записать.
+func (m *Memory) WriteAtomic(ctx context.Context,
+	data models.Data, ttl models.TTL, expected models.Versions,
+) (models.Versions, error) {
+	const op = "memory.WriteAtomic"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w: %w", op, kvstore.ErrRolledBack, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, v := range expected {
+		if _, ok := data[k]; !ok {
+			continue
+		}
+
+		if current := m.current(k); current != v {
+			log.Error("Версия ключа изменилась", slog.String("key", k))
+			return nil, fmt.Errorf("%s: %w: %w: %s", op, kvstore.ErrRolledBack, kvstore.ErrVersionConflict, k)
+		}
+	}
+
+	versions := make(models.Versions, len(data))
+	for k, v := range data {
+		versions[k] = m.put(k, v, ttl[k])
+	}
+
+	log.Info("Данные записаны в память")
+	return versions, nil
+}
+
+func (m *Memory) Incr(ctx context.Context,
+	deltas map[string]float64,
+) (map[string]float64, models.Versions, error) {
+	const op = "memory.Incr"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Сначала проверяются все значения, чтобы при ошибке ничего не изменить
+	for k := range deltas {
+		e, ok := m.storage[k]
+		if !ok || kvstore.Expired(e.expiresAt) {
+			continue
+		}
+
+		if _, ok := toFloat(e.value); !ok {
+			log.Error("Значение ключа не является числом", slog.String("key", k))
+			return nil, nil, fmt.Errorf("%s: %w: %s", op, kvstore.ErrNotNumeric, k)
+		}
+	}
+
+	values := make(map[string]float64, len(deltas))
+	versions := make(models.Versions, len(deltas))
+	for k, delta := range deltas {
+		value, version := delta, m.nextVersion()
+		var expiresAt uint64
+		if e, ok := m.storage[k]; ok {
+			if !kvstore.Expired(e.expiresAt) {
+				current, _ := toFloat(e.value)
+				value += current
+				expiresAt = e.expiresAt
+			}
+		}
+
+		m.storage[k] = &entry{value: value, expiresAt: expiresAt, version: version}
+		values[k] = value
+		versions[k] = version
+		m.hub.Publish(&models.Event{Key: k, Value: value, Version: version, Op: models.EventPut})
+	}
+
+	log.Info("Значения ключей увеличены")
+	return values, versions, nil
+}
+
+// toFloat возвращает числовое значение ключа
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func (m *Memory) Read(ctx context.Context, keys []string) (models.Data, models.Versions, []string, error) {
+	const op = "memory.Read"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return nil, nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data := make(models.Data, len(keys))
+	versions := make(models.Versions, len(keys))
+	missing := make([]string, 0)
+	for _, key := range keys {
+		e, ok := m.storage[key]
+		if !ok || kvstore.Expired(e.expiresAt) {
+			missing = append(missing, key)
+			continue
+		}
+
+		data[key] = e.value
+		versions[key] = e.version
+	}
+	slices.Sort(missing)
+	missing = slices.Compact(missing)
+
+	log.Info("Данные из памяти получены", slog.Int("missing", len(missing)))
+	return data, versions, missing, nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (*models.Pair, error) {
+	const op = "memory.Get"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	e, ok := m.storage[key]
+	if !ok || kvstore.Expired(e.expiresAt) {
+		log.Info("Запись не найдена", slog.String("key", key))
+		return nil, fmt.Errorf("%s: %w", op, kvstore.ErrDataNotFound)
+	}
+
+	return &models.Pair{Key: key, Value: e.value, ExpiresAt: e.expiresAt, Version: e.version}, nil
+}
+
+func (m *Memory) Scan(ctx context.Context,
+	prefix, after string, limit int,
+) ([]*models.Pair, string, error) {
+	const op = "memory.Scan"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]string, 0)
+	for k, e := range m.storage {
+		if strings.HasPrefix(k, prefix) && k > after && !kvstore.Expired(e.expiresAt) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	next := ""
+	if len(keys) > limit {
+		keys = keys[:limit]
+		next = keys[limit-1]
+	}
+
+	pairs := make([]*models.Pair, 0, len(keys))
+	for _, k := range keys {
+		e := m.storage[k]
+		pairs = append(pairs, &models.Pair{
+			Key: k, Value: e.value, ExpiresAt: e.expiresAt, Version: e.version,
+		})
+	}
+
+	log.Info("Ключи найдены", slog.Int("count", len(pairs)))
+	return pairs, next, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, keys []string) ([]string, error) {
+	const op = "memory.Delete"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		e, ok := m.storage[key]
+		if !ok {
+			continue
+		}
+
+		delete(m.storage, key)
+		m.hub.Publish(&models.Event{Key: key, Version: e.version, Op: models.EventDelete})
+		if !kvstore.Expired(e.expiresAt) {
+			deleted = append(deleted, key)
+		}
+	}
+
+	log.Info("Данные удалены из памяти", slog.Int("deleted", len(deleted)))
+	return deleted, nil
+}
+
+func (m *Memory) DeleteVersion(ctx context.Context, key string, expected uint64) (bool, error) {
+	const op = "memory.DeleteVersion"
+	log := m.log.With(slog.String("op", op), slog.String("key", key))
+
+	if err := ctx.Err(); err != nil {
+		log.Error("Контекст завершен", slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := m.current(key)
+	if current != expected {
+		log.Error("Версия ключа изменилась")
+		return false, fmt.Errorf("%s: %w: %s", op, kvstore.ErrVersionConflict, key)
+	}
+	if current == 0 {
+		return false, nil
+	}
+
+	delete(m.storage, key)
+	m.hub.Publish(&models.Event{Key: key, Version: current, Op: models.EventDelete})
+	log.Info("Ключ удален из памяти")
+	return true, nil
+}
@@ -0,0 +1,224 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"vk-intern/internal/kvstore"
+	"vk-intern/internal/models"
+)
+
+func newTestMemory(t *testing.T) *Memory {
+	t.Helper()
+
+	m := New(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(m.Stop)
+	return m
+}
+
+// expire отмечает ключ истекшим, как если бы фоновое удаление еще не успело его удалить
+func expire(m *Memory, key string) {
+	m.mu.Lock()
+	m.storage[key].expiresAt = uint64(time.Now().Add(-time.Minute).Unix())
+	m.mu.Unlock()
+}
+
+func TestReadSkipsExpired(t *testing.T) {
+	m := newTestMemory(t)
+	ctx := context.Background()
+
+	ttl := models.TTL{"k:dead": time.Minute}
+	if _, _, err := m.Write(ctx, models.Data{"k:live": 1, "k:dead": 2}, ttl, nil); err != nil {
+		t.Fatal(err)
+	}
+	expire(m, "k:dead")
+
+	data, _, missing, err := m.Read(ctx, []string{"k:live", "k:dead"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := data["k:dead"]; ok || data["k:live"] != 1 {
+		t.Errorf("прочитано %v, want только k:live", data)
+	}
+	if !slices.Equal(missing, []string{"k:dead"}) {
+		t.Errorf("missing %v, want [k:dead]", missing)
+	}
+}
+
+func TestVersionsNotReused(t *testing.T) {
+	m := newTestMemory(t)
+	ctx := context.Background()
+
+	first, _, err := m.Write(ctx, models.Data{"k": 1}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Delete(ctx, []string{"k"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ключ, созданный заново, не получает прежнюю версию,
+	// поэтому устаревшая ожидаемая версия не проходит проверку
+	second, _, err := m.Write(ctx, models.Data{"k": 2}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second["k"] <= first["k"] {
+		t.Errorf("версия после пересоздания %d, want больше %d", second["k"], first["k"])
+	}
+
+	_, failed, err := m.Write(ctx, models.Data{"k": 3}, nil, models.Versions{"k": first["k"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed["k"] == nil {
+		t.Error("запись с устаревшей версией прошла проверку")
+	}
+}
+
+func TestScanPaging(t *testing.T) {
+	m := newTestMemory(t)
+	ctx := context.Background()
+
+	data := models.Data{"other": 0}
+	for i := range 7 {
+		data[fmt.Sprintf("p:%d", i)] = i
+	}
+	if _, failed, err := m.Write(ctx, data, nil, nil); err != nil || len(failed) != 0 {
+		t.Fatalf("Write: %v %v", err, failed)
+	}
+
+	tests := []struct {
+		limit int
+		pages [][]string
+	}{
+		{limit: 3, pages: [][]string{{"p:0", "p:1", "p:2"}, {"p:3", "p:4", "p:5"}, {"p:6"}}},
+		{limit: 7, pages: [][]string{{"p:0", "p:1", "p:2", "p:3", "p:4", "p:5", "p:6"}}},
+		{limit: 10, pages: [][]string{{"p:0", "p:1", "p:2", "p:3", "p:4", "p:5", "p:6"}}},
+	}
+
+	for _, tt := range tests {
+		after := ""
+		for i, want := range tt.pages {
+			pairs, next, err := m.Scan(ctx, "p:", after, tt.limit)
+			if err != nil {
+				t.Fatalf("limit %d, страница %d: %v", tt.limit, i, err)
+			}
+
+			got := make([]string, 0, len(pairs))
+			for _, pair := range pairs {
+				got = append(got, pair.Key)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("limit %d, страница %d: ключи %v, want %v", tt.limit, i, got, want)
+			}
+
+			// Курсор указывает на последний ключ страницы, пока есть следующие
+			last := i == len(tt.pages)-1
+			if last && next != "" {
+				t.Errorf("limit %d: на последней странице курсор %q, want пустой", tt.limit, next)
+			}
+			if !last && next != want[len(want)-1] {
+				t.Errorf("limit %d, страница %d: курсор %q, want %q", tt.limit, i, next, want[len(want)-1])
+			}
+			after = next
+		}
+	}
+}
+
+func TestScanSkipsExpired(t *testing.T) {
+	m := newTestMemory(t)
+	ctx := context.Background()
+
+	if _, _, err := m.Write(ctx, models.Data{"k:live": 1, "k:dead": 2}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	expire(m, "k:dead")
+
+	pairs, next, err := m.Scan(ctx, "k:", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 1 || pairs[0].Key != "k:live" || next != "" {
+		t.Errorf("Scan = %v, %q, want только k:live без курсора", pairs, next)
+	}
+}
+
+func TestDeleteUserCascade(t *testing.T) {
+	m := newTestMemory(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"bob", "eve"} {
+		if err := m.CreateUser(ctx, &models.User{Username: name, Roles: []string{models.RoleReader}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.CreateAPIKey(ctx, &models.APIKey{ID: name, Username: name}); err != nil {
+			t.Fatal(err)
+		}
+		grant := &models.Grant{Subject: models.UserSubject(name), Prefix: name + ":", Read: true}
+		if err := m.PutGrant(ctx, grant); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.DeleteUser(ctx, "bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]int{"bob": 0, "eve": 1} {
+		keys, err := m.ListAPIKeys(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		grants, err := m.ListGrants(ctx, []string{models.UserSubject(name)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != want || len(grants) != want {
+			t.Errorf("%s: ключей %d и правил %d, want по %d", name, len(keys), len(grants), want)
+		}
+	}
+}
+
+func TestLoginFailed(t *testing.T) {
+	m := newTestMemory(t)
+	ctx := context.Background()
+	policy := &models.LockoutPolicy{
+		MaxFailures: 3,
+		BaseDelay:   time.Second,
+		MaxDelay:    time.Minute,
+		Lockout:     time.Hour,
+		Window:      time.Hour,
+	}
+
+	for failures := uint64(1); failures <= policy.MaxFailures+1; failures++ {
+		before := uint64(time.Now().Unix())
+		got, err := m.LoginFailed(ctx, "user:bob", policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := kvstore.LockedUntil(failures, before, policy); got < want || got > want+1 {
+			t.Errorf("неудача %d: вход заблокирован до %d, want %d", failures, got, want)
+		}
+	}
+
+	lockedUntil, err := m.LoginLockedUntil(ctx, []string{"ip:1.2.3.4", "user:bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lockedUntil <= uint64(time.Now().Add(time.Minute).Unix()) {
+		t.Errorf("после %d неудач вход заблокирован до %d, want на lockout", policy.MaxFailures+1, lockedUntil)
+	}
+
+	if err := m.ResetLoginFailures(ctx, "user:bob"); err != nil {
+		t.Fatal(err)
+	}
+	if lockedUntil, err := m.LoginLockedUntil(ctx, []string{"user:bob"}); err != nil || lockedUntil != 0 {
+		t.Errorf("после сброса вход заблокирован до %d, %v", lockedUntil, err)
+	}
+}
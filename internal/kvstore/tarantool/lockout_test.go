@@ -0,0 +1,45 @@
+package tarantool
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"vk-intern/internal/kvstore"
+	"vk-intern/internal/models"
+)
+
+// TestLoginFailedMatchesLockedUntil проверяет, что kv_login_failed из tarantInit.lua
+// считает блокировку так же, как kvstore.LockedUntil в хранилище в памяти
+func TestLoginFailedMatchesLockedUntil(t *testing.T) {
+	db := newTestTarantool(t)
+	ctx := context.Background()
+
+	policies := []*models.LockoutPolicy{
+		{MaxFailures: 5, BaseDelay: time.Second, MaxDelay: time.Minute, Lockout: 15 * time.Minute, Window: time.Hour},
+		{MaxFailures: 10, BaseDelay: 3 * time.Second, MaxDelay: 10 * time.Second, Lockout: time.Hour, Window: time.Hour},
+		{MaxFailures: 3, BaseDelay: 1500 * time.Millisecond, MaxDelay: 2 * time.Second, Lockout: time.Minute, Window: time.Hour},
+		{MaxFailures: 1, BaseDelay: time.Second, MaxDelay: time.Second, Lockout: time.Minute, Window: time.Hour},
+	}
+
+	for i, policy := range policies {
+		subject := fmt.Sprintf("user:lockout-test-%d-%d", time.Now().UnixNano(), i)
+		t.Cleanup(func() { _ = db.ResetLoginFailures(ctx, subject) })
+
+		for failures := uint64(1); failures <= policy.MaxFailures+1; failures++ {
+			before := uint64(time.Now().Unix())
+			got, err := db.LoginFailed(ctx, subject, policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after := uint64(time.Now().Unix())
+
+			if low, high := kvstore.LockedUntil(failures, before, policy),
+				kvstore.LockedUntil(failures, after, policy); got < low || got > high {
+				t.Errorf("policy %+v, неудача %d: kv_login_failed = %d, LockedUntil = %d..%d",
+					policy, failures, got, low, high)
+			}
+		}
+	}
+}
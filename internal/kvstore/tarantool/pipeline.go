@@ -0,0 +1,48 @@
+package tarantool
+
+import (
+	"context"
+
+	"github.com/tarantool/go-tarantool/v2"
+)
+
+// pipeline отправляет n запросов request(i) по одному соединению, не дожидаясь ответов,
+// и передает ответы в handle в порядке отправки. Запросы отправляются окнами
+// по cfg.PipelineWindow, каждое окно занимает слот t.inflight до получения всех ответов,
+// поэтому число ожидающих ответа запросов ограничено для всех вызовов вместе.
+// Если handle вернул ошибку, оставшиеся запросы не отправляются.
+func (t *Tarantool) pipeline(ctx context.Context, n int,
+	request func(i int) tarantool.Request,
+	handle func(i int, fut *tarantool.Future) error,
+) error {
+	window := max(t.cfg.PipelineWindow, 1)
+	futures := make([]*tarantool.Future, 0, min(n, window))
+
+	for start := 0; start < n; start += window {
+		select {
+		case t.inflight <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		end := min(start+window, n)
+		futures = futures[:0]
+		for i := start; i < end; i++ {
+			futures = append(futures, t.conn.Do(request(i)))
+		}
+
+		var err error
+		for i, fut := range futures {
+			if err = handle(start+i, fut); err != nil {
+				break
+			}
+		}
+
+		<-t.inflight
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
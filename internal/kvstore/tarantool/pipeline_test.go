@@ -0,0 +1,170 @@
+package tarantool
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"vk-intern/internal/config"
+	"vk-intern/internal/models"
+
+	"github.com/tarantool/go-tarantool/v2"
+)
+
+// Бенчмарки сравнивают pipeline с прежними рабочими горутинами на 1, 100 и 10000 ключах.
+// Нужен запущенный Tarantool с tarantInit.lua, адрес задается в TARANTOOL_ADDR:
+//
+//	TARANTOOL_ADDR=localhost:3301 go test -run '^$' -bench . ./internal/kvstore/tarantool/
+//
+// Пользователь и пароль по умолчанию storage/admin, меняются через TARANTOOL_USER и TARANTOOL_PASS.
+var benchSizes = []int{1, 100, 10000}
+
+// newTestTarantool подключается к Tarantool из TARANTOOL_ADDR,
+// а если адрес не задан, пропускает тест или бенчмарк
+func newTestTarantool(tb testing.TB) *Tarantool {
+	tb.Helper()
+
+	addr := os.Getenv("TARANTOOL_ADDR")
+	if addr == "" {
+		tb.Skip("TARANTOOL_ADDR не задан")
+	}
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		tb.Fatalf("некорректный TARANTOOL_ADDR: %v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		tb.Fatalf("некорректный порт в TARANTOOL_ADDR: %v", err)
+	}
+
+	cfg := &config.TarantoolConfig{
+		Host:           host,
+		Port:           port,
+		User:           envOr("TARANTOOL_USER", "storage"),
+		Pass:           envOr("TARANTOOL_PASS", "admin"),
+		Timeout:        10 * time.Second,
+		PipelineWindow: 1000,
+		MaxInFlight:    16,
+	}
+
+	t, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		tb.Fatalf("не удалось подключиться к Tarantool: %v", err)
+	}
+	tb.Cleanup(t.Stop)
+	return t
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func benchKeys(n int) ([]string, models.Data) {
+	keys := make([]string, n)
+	data := make(models.Data, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("bench:%d:%d", n, i)
+		data[keys[i]] = i
+	}
+	return keys, data
+}
+
+func BenchmarkRead(b *testing.B) {
+	t := newTestTarantool(b)
+	ctx := context.Background()
+
+	for _, n := range benchSizes {
+		keys, data := benchKeys(n)
+		if _, _, err := t.Write(ctx, data, nil, nil); err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(fmt.Sprintf("workers/%d", n), func(b *testing.B) {
+			for range b.N {
+				err := t.workers(len(keys), func(i int) tarantool.Request {
+					return getRequest(ctx, keys[i])
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("pipeline/%d", n), func(b *testing.B) {
+			for range b.N {
+				if _, _, _, err := t.Read(ctx, keys); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	t := newTestTarantool(b)
+	ctx := context.Background()
+
+	for _, n := range benchSizes {
+		keys, data := benchKeys(n)
+
+		b.Run(fmt.Sprintf("workers/%d", n), func(b *testing.B) {
+			for range b.N {
+				err := t.workers(len(keys), func(i int) tarantool.Request {
+					return putRequest(ctx, &models.Pair{Key: keys[i], Value: data[keys[i]]}, nil)
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("pipeline/%d", n), func(b *testing.B) {
+			for range b.N {
+				if _, failed, err := t.Write(ctx, data, nil, nil); err != nil || len(failed) != 0 {
+					b.Fatal(err, failed)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDelete(b *testing.B) {
+	t := newTestTarantool(b)
+	ctx := context.Background()
+
+	for _, n := range benchSizes {
+		keys, data := benchKeys(n)
+
+		run := func(del func(context.Context, []string) ([]string, error)) func(b *testing.B) {
+			return func(b *testing.B) {
+				for range b.N {
+					// Ключи заново записываются вне замера, чтобы каждый раз удалялись существующие
+					b.StopTimer()
+					if _, _, err := t.Write(ctx, data, nil, nil); err != nil {
+						b.Fatal(err)
+					}
+					b.StartTimer()
+
+					if _, err := del(ctx, keys); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		}
+
+		b.Run(fmt.Sprintf("workers/%d", n), run(func(ctx context.Context, keys []string) ([]string, error) {
+			return nil, t.workers(len(keys), func(i int) tarantool.Request {
+				return deleteRequest(ctx, keys[i])
+			})
+		}))
+		b.Run(fmt.Sprintf("pipeline/%d", n), run(t.Delete))
+	}
+}
@@ -5,20 +5,19 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"sync"
+	"slices"
+	"strings"
+	"time"
 
 	"vk-intern/internal/config"
 	"vk-intern/internal/kvstore"
+	"vk-intern/internal/metrics"
 	"vk-intern/internal/models"
 
+	"github.com/tarantool/go-iproto"
 	"github.com/tarantool/go-tarantool/v2"
 )
 
-const (
-	numWriter = 4
-	numReader = 4
-)
-
 var (
 	ErrChanIsClosed = errors.New("Канал закрыт")
 )
@@ -28,6 +27,12 @@ type Tarantool struct {
 	log *slog.Logger
 
 	conn *tarantool.Connection
+	// Слоты для окон запросов pipeline
+	inflight chan struct{}
+
+	hub     *kvstore.Hub
+	watcher tarantool.Watcher
+	done    chan struct{}
 }
 
 func New(cfg *config.TarantoolConfig, logger *slog.Logger) (*Tarantool, error) {
@@ -60,22 +65,55 @@ func New(cfg *config.TarantoolConfig, logger *slog.Logger) (*Tarantool, error) {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	log.Info("Подключение к Tarantool прошло успешно")
-	return &Tarantool{
+	t := &Tarantool{
 		cfg: cfg,
 		log: logger,
 
-		conn: conn,
-	}, nil
+		conn:     conn,
+		inflight: make(chan struct{}, max(cfg.MaxInFlight, 1)),
+
+		hub:  kvstore.NewHub(),
+		done: make(chan struct{}),
+	}
+
+	// Без подписки на изменения хранилище работает, недоступен только api/watch
+	if err := t.startWatch(); err != nil {
+		log.Error("Не удалось подписаться на изменения ключей", slog.String("error", err.Error()))
+	}
+
+	log.Info("Подключение к Tarantool прошло успешно")
+	return t, nil
 }
 
 func (t *Tarantool) Stop() {
+	t.stopWatch()
 	t.conn.CloseGraceful()
 }
 
-func (t *Tarantool) GetUser(ctx context.Context, username string) (*models.User, error) {
+// Ping проверяет, что соединение установлено и Tarantool отвечает на запросы.
+// Вызывается пробой готовности, поэтому успешные проверки не логируются.
+func (t *Tarantool) Ping(ctx context.Context) (err error) {
+	const op = "tarantool.Ping"
+	log := t.log.With(slog.String("op", op))
+	defer metrics.ObserveTarantool("Ping", time.Now(), &err)
+
+	if !t.conn.ConnectedNow() {
+		log.Error("Нет соединения с Tarantool")
+		return fmt.Errorf("%s: %w", op, kvstore.ErrNotConnected)
+	}
+
+	if _, err = t.conn.Do(tarantool.NewPingRequest().Context(ctx)).Get(); err != nil {
+		log.Error("Tarantool не ответил на ping", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (t *Tarantool) GetUser(ctx context.Context, username string) (_ *models.User, err error) {
 	const op = "tarantool.GetUser"
 	log := t.log.With(slog.String("op", op))
+	defer metrics.ObserveTarantool("GetUser", time.Now(), &err)
 
 	log.Info("Получение пользователя")
 	req := tarantool.NewSelectRequest("kv_users").
@@ -100,184 +138,860 @@ func (t *Tarantool) GetUser(ctx context.Context, username string) (*models.User,
 	return user[0], nil
 }
 
-func (t *Tarantool) Write(ctx context.Context, data models.Data) error {
-	const op = "tarantool.Write"
+func (t *Tarantool) CreateUser(ctx context.Context, user *models.User) error {
+	const op = "tarantool.CreateUser"
+	log := t.log.With(slog.String("op", op))
+
+	log.Info("Создание пользователя", slog.String("username", user.Username))
+	req := tarantool.NewInsertRequest("kv_users").
+		Context(ctx).
+		Tuple([]interface{}{user.Username, user.Password, user.Roles})
+
+	if _, err := t.conn.Do(req).Get(); err != nil {
+		var tntErr tarantool.Error
+		if errors.As(err, &tntErr) && tntErr.Code == iproto.ER_TUPLE_FOUND {
+			log.Error("Пользователь уже существует")
+			return fmt.Errorf("%s: %w", op, kvstore.ErrUserExists)
+		}
+
+		log.Error("Не удалось создать пользователя", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Пользователь создан")
+	return nil
+}
+
+func (t *Tarantool) ListUsers(ctx context.Context) ([]*models.User, error) {
+	const op = "tarantool.ListUsers"
+	log := t.log.With(slog.String("op", op))
+
+	log.Info("Получение списка пользователей")
+	req := tarantool.NewSelectRequest("kv_users").
+		Context(ctx).
+		Index("primary").
+		Iterator(tarantool.IterAll)
+
+	users := []*models.User{}
+	if err := t.conn.Do(req).GetTyped(&users); err != nil {
+		log.Error("Не удалось получить пользователей из БД", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Пользователи получены", slog.Int("count", len(users)))
+	return users, nil
+}
+
+func (t *Tarantool) UpdateUser(ctx context.Context, user *models.User) error {
+	const op = "tarantool.UpdateUser"
+	log := t.log.With(slog.String("op", op))
+
+	// Обновляются только заданные поля
+	ops := tarantool.NewOperations()
+	if user.Password != "" {
+		ops = ops.Assign(1, user.Password)
+	}
+	if user.Roles != nil {
+		ops = ops.Assign(2, user.Roles)
+	}
+
+	log.Info("Обновление пользователя", slog.String("username", user.Username))
+	req := tarantool.NewUpdateRequest("kv_users").
+		Context(ctx).
+		Index("primary").
+		Key(tarantool.StringKey{S: user.Username}).
+		Operations(ops)
+
+	updated := []*models.User{}
+	if err := t.conn.Do(req).GetTyped(&updated); err != nil {
+		log.Error("Не удалось обновить пользователя", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(updated) == 0 {
+		log.Error("Пользователь не найден")
+		return fmt.Errorf("%s: %w", op, kvstore.ErrUserNotFound)
+	}
+
+	log.Info("Пользователь обновлен")
+	return nil
+}
+
+// DeleteUser удаляет пользователя вместе с его API-ключами и правилами доступа
+// в одной транзакции через kv_delete_user
+func (t *Tarantool) DeleteUser(ctx context.Context, username string) error {
+	const op = "tarantool.DeleteUser"
 	log := t.log.With(slog.String("op", op))
 
-	wg := sync.WaitGroup{}
+	log.Info("Удаление пользователя", slog.String("username", username))
+	req := tarantool.NewCallRequest("kv_delete_user").
+		Context(ctx).
+		Args([]interface{}{username})
+
+	deleted := []bool{}
+	if err := t.conn.Do(req).GetTyped(&deleted); err != nil {
+		log.Error("Не удалось удалить пользователя", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(deleted) == 0 || !deleted[0] {
+		log.Error("Пользователь не найден")
+		return fmt.Errorf("%s: %w", op, kvstore.ErrUserNotFound)
+	}
 
-	pairCh := make(chan *models.Pair, numWriter)
-	errCh := make(chan error, 1)
+	log.Info("Пользователь удален")
+	return nil
+}
 
-	// Запись пар в канал
-	go func() {
-		for k, v := range data {
-			t := &models.Pair{Key: k, Value: v}
-			pairCh <- t
+// ListGrants возвращает правила доступа для субъектов, при subjects == nil - все правила
+func (t *Tarantool) ListGrants(ctx context.Context, subjects []string) (_ []*models.Grant, err error) {
+	const op = "tarantool.ListGrants"
+	log := t.log.With(slog.String("op", op))
+	defer metrics.ObserveTarantool("ListGrants", time.Now(), &err)
+
+	log.Info("Получение правил доступа", slog.Any("subjects", subjects))
+	if subjects == nil {
+		req := tarantool.NewSelectRequest("kv_acl").
+			Context(ctx).
+			Index("primary").
+			Iterator(tarantool.IterAll)
+
+		grants := []*models.Grant{}
+		if err := t.conn.Do(req).GetTyped(&grants); err != nil {
+			log.Error("Не удалось получить правила доступа", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%s: %w", op, err)
 		}
-		close(pairCh)
-	}()
-
-	// Запуск рабочих горутин для обработки запросов
-	for range numWriter {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			t.writer(ctx, pairCh, errCh)
-		}()
-	}
-
-	// Ожидание выполнения всех рабочих горутин
-	go func() {
-		wg.Wait()
-		close(errCh)
-	}()
-
-	// Ожидание ошибок
-	for err := range errCh {
-		log.Error("Не удалось записать данные",
-			slog.String("error", err.Error()))
+		return grants, nil
+	}
+
+	// Запросы по всем субъектам отправляются сразу, затем собираются ответы
+	futures := make([]*tarantool.Future, 0, len(subjects))
+	for _, subject := range subjects {
+		req := tarantool.NewSelectRequest("kv_acl").
+			Context(ctx).
+			Index("primary").
+			Iterator(tarantool.IterEq).
+			Key([]interface{}{subject})
+		futures = append(futures, t.conn.Do(req))
+	}
+
+	grants := []*models.Grant{}
+	for _, fut := range futures {
+		part := []*models.Grant{}
+		if err := fut.GetTyped(&part); err != nil {
+			log.Error("Не удалось получить правила доступа", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		grants = append(grants, part...)
+	}
+
+	log.Info("Правила доступа получены", slog.Int("count", len(grants)))
+	return grants, nil
+}
+
+func (t *Tarantool) PutGrant(ctx context.Context, grant *models.Grant) error {
+	const op = "tarantool.PutGrant"
+	log := t.log.With(slog.String("op", op))
+
+	log.Info("Сохранение правила доступа", slog.Any("grant", grant))
+	req := tarantool.NewReplaceRequest("kv_acl").
+		Context(ctx).
+		Tuple([]interface{}{grant.Subject, grant.Prefix, grant.Read, grant.Write})
+
+	if _, err := t.conn.Do(req).Get(); err != nil {
+		log.Error("Не удалось сохранить правило доступа", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Правило доступа сохранено")
+	return nil
+}
+
+func (t *Tarantool) DeleteGrant(ctx context.Context, subject, prefix string) error {
+	const op = "tarantool.DeleteGrant"
+	log := t.log.With(slog.String("op", op))
+
+	log.Info("Удаление правила доступа",
+		slog.String("subject", subject), slog.String("prefix", prefix))
+	req := tarantool.NewDeleteRequest("kv_acl").
+		Context(ctx).
+		Index("primary").
+		Key([]interface{}{subject, prefix})
+
+	deleted := []*models.Grant{}
+	if err := t.conn.Do(req).GetTyped(&deleted); err != nil {
+		log.Error("Не удалось удалить правило доступа", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(deleted) == 0 {
+		log.Error("Правило доступа не найдено")
+		return fmt.Errorf("%s: %w", op, kvstore.ErrGrantNotFound)
+	}
+
+	log.Info("Правило доступа удалено")
+	return nil
+}
+
+func (t *Tarantool) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	const op = "tarantool.CreateAPIKey"
+	log := t.log.With(slog.String("op", op))
+
+	log.Info("Создание API-ключа",
+		slog.String("id", key.ID), slog.String("username", key.Username))
+	req := tarantool.NewInsertRequest("kv_api_keys").
+		Context(ctx).
+		Tuple([]interface{}{key.ID, key.Username, key.Hash, key.Name,
+			key.Roles, key.CreatedAt, key.LastUsed})
+
+	if _, err := t.conn.Do(req).Get(); err != nil {
+		log.Error("Не удалось создать API-ключ", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("API-ключ создан")
+	return nil
+}
+
+func (t *Tarantool) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	const op = "tarantool.GetAPIKey"
+	log := t.log.With(slog.String("op", op))
+
+	log.Info("Получение API-ключа", slog.String("id", id))
+	req := tarantool.NewSelectRequest("kv_api_keys").
+		Context(ctx).
+		Index("primary").
+		Limit(1).
+		Iterator(tarantool.IterEq).
+		Key(tarantool.StringKey{S: id})
+
+	keys := []*models.APIKey{}
+	if err := t.conn.Do(req).GetTyped(&keys); err != nil {
+		log.Error("Не удалось получить API-ключ", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(keys) == 0 {
+		log.Error("API-ключ не найден")
+		return nil, fmt.Errorf("%s: %w", op, kvstore.ErrAPIKeyNotFound)
+	}
+
+	return keys[0], nil
+}
+
+// ListAPIKeys возвращает ключи пользователя, при пустом username - ключи всех пользователей
+func (t *Tarantool) ListAPIKeys(ctx context.Context, username string) ([]*models.APIKey, error) {
+	const op = "tarantool.ListAPIKeys"
+	log := t.log.With(slog.String("op", op))
+
+	log.Info("Получение API-ключей", slog.String("username", username))
+	req := tarantool.NewSelectRequest("kv_api_keys").
+		Context(ctx).
+		Index("primary").
+		Iterator(tarantool.IterAll)
+	if username != "" {
+		req = req.Index("username").
+			Iterator(tarantool.IterEq).
+			Key(tarantool.StringKey{S: username})
+	}
+
+	keys := []*models.APIKey{}
+	if err := t.conn.Do(req).GetTyped(&keys); err != nil {
+		log.Error("Не удалось получить API-ключи", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("API-ключи получены", slog.Int("count", len(keys)))
+	return keys, nil
+}
+
+// TouchAPIKey сохраняет время последнего использования ключа
+func (t *Tarantool) TouchAPIKey(ctx context.Context, id string, usedAt uint64) error {
+	const op = "tarantool.TouchAPIKey"
+	log := t.log.With(slog.String("op", op))
+
+	req := tarantool.NewUpdateRequest("kv_api_keys").
+		Context(ctx).
+		Index("primary").
+		Key(tarantool.StringKey{S: id}).
+		Operations(tarantool.NewOperations().Assign(6, usedAt))
+
+	if _, err := t.conn.Do(req).Get(); err != nil {
+		log.Error("Не удалось обновить API-ключ", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (t *Tarantool) DeleteAPIKey(ctx context.Context, id string) error {
+	const op = "tarantool.DeleteAPIKey"
+	log := t.log.With(slog.String("op", op))
+
+	log.Info("Удаление API-ключа", slog.String("id", id))
+	req := tarantool.NewDeleteRequest("kv_api_keys").
+		Context(ctx).
+		Index("primary").
+		Key(tarantool.StringKey{S: id})
+
+	deleted := []*models.APIKey{}
+	if err := t.conn.Do(req).GetTyped(&deleted); err != nil {
+		log.Error("Не удалось удалить API-ключ", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(deleted) == 0 {
+		log.Error("API-ключ не найден")
+		return fmt.Errorf("%s: %w", op, kvstore.ErrAPIKeyNotFound)
+	}
+
+	log.Info("API-ключ удален")
+	return nil
+}
+
+// RevokeToken добавляет идентификатор токена в список отозванных.
+// Запись хранится до истечения токена, после чего удаляется в tarantInit.lua.
+func (t *Tarantool) RevokeToken(ctx context.Context, id string, expiresAt uint64) error {
+	const op = "tarantool.RevokeToken"
+	log := t.log.With(slog.String("op", op))
+
+	log.Info("Отзыв токена", slog.String("jti", id))
+	req := tarantool.NewReplaceRequest("kv_revoked").
+		Context(ctx).
+		Tuple([]interface{}{id, expiresAt})
+
+	if _, err := t.conn.Do(req).Get(); err != nil {
+		log.Error("Не удалось отозвать токен", slog.String("error", err.Error()))
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Если ошибок нет, значит все прошло успешно
-	log.Info("Данные записаны в БД")
+	log.Info("Токен отозван")
 	return nil
 }
 
-func (t *Tarantool) writer(ctx context.Context,
-	pairCh <-chan *models.Pair, errCh chan<- error,
-) {
-	const op = "tarantool.writer"
+func (t *Tarantool) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	const op = "tarantool.IsTokenRevoked"
+	log := t.log.With(slog.String("op", op))
+
+	req := tarantool.NewSelectRequest("kv_revoked").
+		Context(ctx).
+		Index("primary").
+		Limit(1).
+		Iterator(tarantool.IterEq).
+		Key(tarantool.StringKey{S: id})
+
+	revoked, err := t.conn.Do(req).Get()
+	if err != nil {
+		log.Error("Не удалось проверить токен", slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return len(revoked) != 0, nil
+}
+
+// LoginFailed учитывает неудачную попытку входа субъекта и возвращает время,
+// до которого вход заблокирован. Счетчик обновляется атомарно в kv_login_failed.
+func (t *Tarantool) LoginFailed(ctx context.Context,
+	subject string, policy *models.LockoutPolicy,
+) (uint64, error) {
+	const op = "tarantool.LoginFailed"
+	log := t.log.With(slog.String("op", op))
+
+	log.Info("Учет неудачной попытки входа", slog.String("subject", subject))
+	req := tarantool.NewCallRequest("kv_login_failed").
+		Context(ctx).
+		Args([]interface{}{subject, policy.MaxFailures,
+			kvstore.Seconds(policy.BaseDelay), kvstore.Seconds(policy.MaxDelay),
+			kvstore.Seconds(policy.Lockout), kvstore.Seconds(policy.Window)})
+
+	lockedUntil := []uint64{}
+	if err := t.conn.Do(req).GetTyped(&lockedUntil); err != nil {
+		log.Error("Не удалось учесть попытку входа", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(lockedUntil) == 0 {
+		return 0, fmt.Errorf("%s: пустой ответ kv_login_failed", op)
+	}
+
+	return lockedUntil[0], nil
+}
+
+// LoginLockedUntil возвращает наибольшее время блокировки входа среди субъектов
+func (t *Tarantool) LoginLockedUntil(ctx context.Context, subjects []string) (uint64, error) {
+	const op = "tarantool.LoginLockedUntil"
 	log := t.log.With(slog.String("op", op))
 
-	for {
-		select {
-		case <-ctx.Done():
-			log.Error("Контекст завершен", slog.String("error", ctx.Err().Error()))
-			errCh <- ctx.Err()
-			return
-		case pair, ok := <-pairCh:
-			if !ok {
-				log.Error("Канал закрыт")
-				return
+	futures := make([]*tarantool.Future, 0, len(subjects))
+	for _, subject := range subjects {
+		req := tarantool.NewSelectRequest("kv_login_attempts").
+			Context(ctx).
+			Index("primary").
+			Limit(1).
+			Iterator(tarantool.IterEq).
+			Key(tarantool.StringKey{S: subject})
+		futures = append(futures, t.conn.Do(req))
+	}
+
+	var lockedUntil uint64
+	for _, fut := range futures {
+		attempts := []*loginAttempts{}
+		if err := fut.GetTyped(&attempts); err != nil {
+			log.Error("Не удалось получить попытки входа", slog.String("error", err.Error()))
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		// Запись могла истечь, но еще не удалена в tarantInit.lua
+		for _, a := range attempts {
+			if !kvstore.Expired(a.ExpiresAt) {
+				lockedUntil = max(lockedUntil, a.LockedUntil)
 			}
+		}
+	}
+
+	return lockedUntil, nil
+}
+
+// ResetLoginFailures сбрасывает счетчик неудачных попыток входа субъекта
+func (t *Tarantool) ResetLoginFailures(ctx context.Context, subject string) error {
+	const op = "tarantool.ResetLoginFailures"
+	log := t.log.With(slog.String("op", op))
+
+	req := tarantool.NewDeleteRequest("kv_login_attempts").
+		Context(ctx).
+		Index("primary").
+		Key(tarantool.StringKey{S: subject})
+
+	if _, err := t.conn.Do(req).Get(); err != nil {
+		log.Error("Не удалось сбросить попытки входа", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Write записывает пары независимо друг от друга, вызовы kv_put отправляются
+// через pipeline без ожидания ответов. Ошибка записи одного ключа
+// не прерывает запись остальных: успешно записанные ключи возвращаются с версиями,
+// остальные - с ошибками. Ключи, которые не успели отправить до завершения ctx,
+// получают ошибку контекста.
+func (t *Tarantool) Write(ctx context.Context,
+	data models.Data, ttl models.TTL, expected models.Versions,
+) (_ models.Versions, _ map[string]error, err error) {
+	const op = "tarantool.Write"
+	log := t.log.With(slog.String("op", op))
+	defer metrics.ObserveTarantool("Write", time.Now(), &err)
+
+	pairs := make([]*models.Pair, 0, len(data))
+	for k, v := range data {
+		pairs = append(pairs, &models.Pair{Key: k, Value: v, ExpiresAt: kvstore.ExpiresAt(ttl[k])})
+	}
 
-			log.Info("Запись в БД", slog.String("key", pair.Key), slog.Any("value", pair.Value))
-			req := tarantool.NewReplaceRequest("kv_storage").
-				Context(ctx).
-				Tuple([]interface{}{pair.Key, pair.Value})
+	versions := make(models.Versions, len(data))
+	failed := make(map[string]error)
+
+	log.Info("Запись в БД", slog.Int("keys", len(pairs)))
+	err = t.pipeline(ctx, len(pairs), func(i int) tarantool.Request {
+		return putRequest(ctx, pairs[i], expected)
+	}, func(i int, fut *tarantool.Future) error {
+		key := pairs[i].Key
+
+		res := putResult{}
+		if err := fut.GetTyped(&res); err != nil {
+			log.Error("Не удалось записать данные в БД",
+				slog.String("key", key), slog.String("error", err.Error()))
+			// Write возвращает ошибки ключей без общей ошибки, поэтому они учитываются здесь
+			metrics.TarantoolErrors.WithLabelValues("Write").Inc()
+			failed[key] = err
+			return nil
+		}
+
+		if res.Conflict {
+			log.Error("Версия ключа изменилась", slog.String("key", key))
+			failed[key] = fmt.Errorf("%w: %s", kvstore.ErrVersionConflict, key)
+			return nil
+		}
 
-			data, err := t.conn.Do(req).Get()
-			if err != nil {
-				log.Error("Не удалось записать данные в БД", slog.String("error", err.Error()))
-				errCh <- err
-				return
+		versions[key] = res.Version
+		return nil
+	})
+	if err != nil {
+		for _, pair := range pairs {
+			_, written := versions[pair.Key]
+			if _, ok := failed[pair.Key]; !ok && !written {
+				failed[pair.Key] = err
 			}
+		}
+	}
+
+	if len(failed) != 0 {
+		log.Error("Часть данных не записана", slog.Int("failed", len(failed)))
+	}
+
+	log.Info("Данные записаны в БД", slog.Int("written", len(versions)))
+	return versions, failed, nil
+}
 
-			log.Info("Данные записаны в БД", slog.Any("data", data))
+// WriteAtomic записывает все пары в одной транзакции.
+// При любой ошибке транзакция откатывается и ни одна пара не записывается.
+func (t *Tarantool) WriteAtomic(ctx context.Context,
+	data models.Data, ttl models.TTL, expected models.Versions,
+) (_ models.Versions, err error) {
+	const op = "tarantool.WriteAtomic"
+	log := t.log.With(slog.String("op", op))
+	defer metrics.ObserveTarantool("WriteAtomic", time.Now(), &err)
+
+	stream, err := t.conn.NewStream()
+	if err != nil {
+		log.Error("Не удалось создать поток", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w: %w", op, kvstore.ErrRolledBack, err)
+	}
+
+	log.Info("Начало транзакции")
+	begin := tarantool.NewBeginRequest().
+		Context(ctx).
+		TxnIsolation(tarantool.ReadCommittedLevel).
+		Timeout(t.cfg.Timeout)
+	if _, err := stream.Do(begin).Get(); err != nil {
+		log.Error("Не удалось начать транзакцию", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w: %w", op, kvstore.ErrRolledBack, err)
+	}
+
+	// Запросы внутри потока выполняются по порядку,
+	// поэтому их можно отправить все сразу и затем дождаться ответов
+	keys := make([]string, 0, len(data))
+	futures := make([]*tarantool.Future, 0, len(data))
+	for k, v := range data {
+		log.Info("Запись в БД", slog.String("key", k), slog.Any("value", v))
+		pair := &models.Pair{Key: k, Value: v, ExpiresAt: kvstore.ExpiresAt(ttl[k])}
+		keys = append(keys, k)
+		futures = append(futures, stream.Do(putRequest(ctx, pair, expected)))
+	}
+
+	versions := make(models.Versions, len(data))
+	for i, fut := range futures {
+		res := putResult{}
+		if err := fut.GetTyped(&res); err != nil {
+			log.Error("Не удалось записать данные в БД", slog.String("error", err.Error()))
+			t.rollback(stream)
+			return nil, fmt.Errorf("%s: %w: %w", op, kvstore.ErrRolledBack, err)
 		}
+
+		if res.Conflict {
+			log.Error("Версия ключа изменилась", slog.String("key", keys[i]))
+			t.rollback(stream)
+			return nil, fmt.Errorf("%s: %w: %w: %s", op,
+				kvstore.ErrRolledBack, kvstore.ErrVersionConflict, keys[i])
+		}
+
+		versions[keys[i]] = res.Version
+	}
+
+	if _, err := stream.Do(tarantool.NewCommitRequest().Context(ctx)).Get(); err != nil {
+		log.Error("Не удалось зафиксировать транзакцию", slog.String("error", err.Error()))
+		t.rollback(stream)
+		return nil, fmt.Errorf("%s: %w: %w", op, kvstore.ErrRolledBack, err)
 	}
+
+	log.Info("Транзакция зафиксирована")
+	return versions, nil
 }
 
-func (t *Tarantool) Read(ctx context.Context, keys []string) (models.Data, error) {
-	const op = "tarantool.Read"
+func (t *Tarantool) rollback(stream *tarantool.Stream) {
+	const op = "tarantool.rollback"
+	log := t.log.With(slog.String("op", op))
+
+	// Контекст запроса может быть уже завершен, поэтому откат без него
+	if _, err := stream.Do(tarantool.NewRollbackRequest()).Get(); err != nil {
+		log.Error("Не удалось откатить транзакцию", slog.String("error", err.Error()))
+		return
+	}
+
+	log.Info("Транзакция откатена")
+}
+
+// Incr атомарно увеличивает числовые значения ключей через kv_incr.
+// Если значение хотя бы одного ключа не число, ничего не меняется.
+func (t *Tarantool) Incr(ctx context.Context,
+	deltas map[string]float64,
+) (_ map[string]float64, _ models.Versions, err error) {
+	const op = "tarantool.Incr"
 	log := t.log.With(slog.String("op", op))
+	defer metrics.ObserveTarantool("Incr", time.Now(), &err)
+
+	log.Info("Увеличение значений ключей", slog.Any("deltas", deltas))
+	req := tarantool.NewCallRequest("kv_incr").
+		Context(ctx).
+		Args([]interface{}{deltas})
+
+	res := incrResult{}
+	if err := t.conn.Do(req).GetTyped(&res); err != nil {
+		log.Error("Не удалось увеличить значения", slog.String("error", err.Error()))
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if res.NotNumeric != "" {
+		log.Error("Значение ключа не является числом", slog.String("key", res.NotNumeric))
+		return nil, nil, fmt.Errorf("%s: %w: %s", op, kvstore.ErrNotNumeric, res.NotNumeric)
+	}
+
+	log.Info("Значения ключей увеличены")
+	return res.Values, res.Versions, nil
+}
 
-	wg := sync.WaitGroup{}
+// Read читает ключи, запросы отправляются через pipeline без ожидания ответов.
+// Отсутствующие и истекшие ключи не попадают в данные и возвращаются отдельным списком
+func (t *Tarantool) Read(ctx context.Context, keys []string) (_ models.Data, _ models.Versions, _ []string, err error) {
+	const op = "tarantool.Read"
+	log := t.log.With(slog.String("op", op))
+	defer metrics.ObserveTarantool("Read", time.Now(), &err)
+
+	data := make(models.Data, len(keys))
+	versions := make(models.Versions, len(keys))
+	missing := make([]string, 0)
+
+	log.Info("Чтение из БД", slog.Int("keys", len(keys)))
+	err = t.pipeline(ctx, len(keys), func(i int) tarantool.Request {
+		return getRequest(ctx, keys[i])
+	}, func(i int, fut *tarantool.Future) error {
+		var pair []*models.Pair
+		if err := fut.GetTyped(&pair); err != nil {
+			return err
+		}
 
-	keyCh := make(chan string, len(keys))
-	pairCh := make(chan *models.Pair, len(keys))
-	errCh := make(chan error, 1)
+		// Истекшие ключи считаются отсутствующими до их удаления
+		if len(pair) == 0 || kvstore.Expired(pair[0].ExpiresAt) {
+			log.Info("Запись не найдена", slog.String("key", keys[i]))
+			missing = append(missing, keys[i])
+			return nil
+		}
 
-	// Запись запросов в канал
-	log.Info("Запись ключей в канал")
-	go func() {
-		for _, key := range keys {
-			keyCh <- key
+		data[keys[i]] = pair[0].Value
+		if pair[0].Version != 0 {
+			versions[keys[i]] = pair[0].Version
 		}
-		close(keyCh)
-	}()
-
-	// Запуск рабочих горутин для обработки запросов
-	log.Info("Запуск читающих горутин")
-	for range numReader {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			t.reader(ctx, keyCh, pairCh, errCh)
-		}()
-	}
-
-	// Ожидание выполнения всех рабочих горутин
-	go func() {
-		wg.Wait()
-		close(pairCh)
-		close(errCh)
-	}()
-
-	// Ожидание ошибок
-	for err := range errCh {
-		log.Info("Не удалось прочитать данные",
+		return nil
+	})
+	if err != nil {
+		log.Error("Не удалось прочитать данные",
 			slog.String("error", err.Error()))
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, nil, nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Запись полученых данных
-	// Если ошибок нет, значит можно передавать данные
-	data := make(models.Data)
+	slices.Sort(missing)
+	missing = slices.Compact(missing)
+
+	log.Info("Данные из БД получены", slog.Int("missing", len(missing)))
+	return data, versions, missing, nil
+}
+
+// Get возвращает пару по ключу. Для отсутствующего или истекшего ключа
+// возвращается ErrDataNotFound
+func (t *Tarantool) Get(ctx context.Context, key string) (_ *models.Pair, err error) {
+	const op = "tarantool.Get"
+	log := t.log.With(slog.String("op", op))
+	defer metrics.ObserveTarantool("Get", time.Now(), &err)
 
-	for pair := range pairCh {
-		log.Info("Получены данные",
-			slog.String("key", pair.Key), slog.Any("value", pair.Value))
-		data[pair.Key] = pair.Value
+	var pair []*models.Pair
+	if err := t.conn.Do(getRequest(ctx, key)).GetTyped(&pair); err != nil {
+		log.Error("Не удалось прочитать данные из БД", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	log.Info("Данные из БД получены")
-	return data, nil
+	if len(pair) == 0 || kvstore.Expired(pair[0].ExpiresAt) {
+		log.Info("Запись не найдена", slog.String("key", key))
+		return nil, fmt.Errorf("%s: %w", op, kvstore.ErrDataNotFound)
+	}
+
+	return pair[0], nil
 }
 
-func (t *Tarantool) reader(ctx context.Context,
-	keyCh <-chan string, pairCh chan<- *models.Pair, errCh chan<- error,
-) {
-	const op = "tarantool.reader"
+// Scan возвращает до limit пар, ключи которых начинаются с prefix и идут после after.
+// Вторым значением возвращается курсор для следующей страницы,
+// пустой курсор означает, что ключей с таким префиксом больше нет.
+func (t *Tarantool) Scan(ctx context.Context,
+	prefix, after string, limit int,
+) (_ []*models.Pair, _ string, err error) {
+	const op = "tarantool.Scan"
 	log := t.log.With(slog.String("op", op))
+	defer metrics.ObserveTarantool("Scan", time.Now(), &err)
 
-	for {
-		select {
-		case <-ctx.Done():
-			log.Error("Контекст завершен", slog.String("error", ctx.Err().Error()))
-			errCh <- ctx.Err()
-			return
-		case key, ok := <-keyCh:
-			if !ok {
-				log.Error("Канал закрыт")
-				return
-			}
+	// Начинаем с префикса или сразу после курсора, если он дальше префикса
+	iter, start := tarantool.IterGe, prefix
+	if after != "" && after >= prefix {
+		iter, start = tarantool.IterGt, after
+	}
 
-			req := tarantool.NewSelectRequest("kv_storage").
-				Context(ctx).
-				Index("primary").
-				Limit(1).
-				Iterator(tarantool.IterEq).
-				Key(tarantool.StringKey{S: key})
-
-			var pair []*models.Pair
-			if err := t.conn.Do(req).GetTyped(&pair); err != nil {
-				log.Error("Не удалось прочитать данные из БД", slog.String("error", err.Error()))
-				errCh <- err
-				return
-			}
+	// Как и в памяти, выбирается на один ключ больше limit: следующая страница есть,
+	// только если после limit ключей остался еще хотя бы один.
+	// Истекшие ключи пропускаются, поэтому выборка повторяется, пока не набрано limit+1.
+	pairs := make([]*models.Pair, 0, limit+1)
+	for len(pairs) <= limit {
+		log.Info("Поиск ключей", slog.String("prefix", prefix), slog.String("start", start))
+		req := tarantool.NewSelectRequest("kv_storage").
+			Context(ctx).
+			Index("primary").
+			Limit(uint32(limit + 1)).
+			Iterator(iter).
+			Key(tarantool.StringKey{S: start})
+
+		var tuples []*models.Pair
+		if err := t.conn.Do(req).GetTyped(&tuples); err != nil {
+			log.Error("Не удалось получить ключи из БД", slog.String("error", err.Error()))
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
 
-			if len(pair) == 0 {
-				log.Error("Запись не найдена")
+		done := len(tuples) <= limit
+		for _, pair := range tuples {
+			// Ключи отсортированы, поэтому первый ключ без префикса завершает поиск
+			if !strings.HasPrefix(pair.Key, prefix) {
+				done = true
+				break
+			}
 
-				// Думаю, не стоит прерываться
-				pairCh <- &models.Pair{Key: key, Value: nil}
+			if kvstore.Expired(pair.ExpiresAt) {
 				continue
 			}
+			pairs = append(pairs, pair)
+		}
+
+		if done {
+			break
+		}
+		iter, start = tarantool.IterGt, tuples[len(tuples)-1].Key
+	}
+
+	next := ""
+	if len(pairs) > limit {
+		pairs = pairs[:limit]
+		next = pairs[limit-1].Key
+	}
+
+	log.Info("Ключи найдены", slog.Int("count", len(pairs)))
+	return pairs, next, nil
+}
+
+// Delete удаляет ключи, запросы отправляются через pipeline без ожидания ответов.
+// Возвращает ключи, которые существовали и были удалены
+func (t *Tarantool) Delete(ctx context.Context, keys []string) (_ []string, err error) {
+	const op = "tarantool.Delete"
+	log := t.log.With(slog.String("op", op))
+	defer metrics.ObserveTarantool("Delete", time.Now(), &err)
+
+	deleted := make([]string, 0, len(keys))
 
-			pairCh <- pair[0]
+	log.Info("Удаление из БД", slog.Int("keys", len(keys)))
+	err = t.pipeline(ctx, len(keys), func(i int) tarantool.Request {
+		return deleteRequest(ctx, keys[i])
+	}, func(i int, fut *tarantool.Future) error {
+		var pair []*models.Pair
+		if err := fut.GetTyped(&pair); err != nil {
+			return err
 		}
+
+		// Delete возвращает удаленный кортеж, если он существовал
+		if len(pair) == 0 || kvstore.Expired(pair[0].ExpiresAt) {
+			log.Info("Запись не найдена", slog.String("key", keys[i]))
+			return nil
+		}
+
+		deleted = append(deleted, keys[i])
+		return nil
+	})
+	if err != nil {
+		log.Error("Не удалось удалить данные",
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Данные удалены из БД", slog.Int("deleted", len(deleted)))
+	return deleted, nil
+}
+
+// DeleteVersion удаляет ключ через kv_delete, только если его текущая версия равна expected.
+// Возвращает false, если ключ не существует.
+func (t *Tarantool) DeleteVersion(ctx context.Context, key string, expected uint64) (bool, error) {
+	const op = "tarantool.DeleteVersion"
+	log := t.log.With(slog.String("op", op), slog.String("key", key))
+
+	log.Info("Удаление из БД с проверкой версии", slog.Uint64("expected", expected))
+	req := tarantool.NewCallRequest("kv_delete").
+		Context(ctx).
+		Args([]interface{}{key, expected})
+
+	res := deleteResult{}
+	if err := t.conn.Do(req).GetTyped(&res); err != nil {
+		log.Error("Не удалось удалить данные из БД", slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if res.Conflict {
+		log.Error("Версия ключа изменилась")
+		return false, fmt.Errorf("%s: %w: %s", op, kvstore.ErrVersionConflict, key)
+	}
+
+	return res.Deleted, nil
+}
+
+// loginAttempts - кортеж kv_login_attempts
+type loginAttempts struct {
+	Subject     string
+	Failures    uint64
+	LockedUntil uint64
+	ExpiresAt   uint64
+}
+
+// incrResult - ответ функции kv_incr из tarantInit.lua
+type incrResult struct {
+	Values     map[string]float64
+	Versions   models.Versions
+	NotNumeric string
+}
+
+// deleteResult - ответ функции kv_delete из tarantInit.lua
+type deleteResult struct {
+	Deleted  bool
+	Conflict bool
+}
+
+// putResult - ответ функции kv_put из tarantInit.lua
+type putResult struct {
+	Version  uint64
+	Conflict bool
+}
+
+// getRequest собирает выборку пары по ключу
+func getRequest(ctx context.Context, key string) *tarantool.SelectRequest {
+	return tarantool.NewSelectRequest("kv_storage").
+		Context(ctx).
+		Index("primary").
+		Limit(1).
+		Iterator(tarantool.IterEq).
+		Key(tarantool.StringKey{S: key})
+}
+
+// deleteRequest собирает удаление пары по ключу
+func deleteRequest(ctx context.Context, key string) *tarantool.DeleteRequest {
+	return tarantool.NewDeleteRequest("kv_storage").
+		Context(ctx).
+		Index("primary").
+		Key(tarantool.StringKey{S: key})
+}
+
+// putRequest собирает вызов kv_put, который записывает пару
+// и увеличивает версию ключа. Если для ключа задана ожидаемая версия,
+// запись выполняется только при ее совпадении с текущей.
+// Для бессрочных ключей expires_at равен null, чтобы они не попадали в индекс expires.
+func putRequest(ctx context.Context, pair *models.Pair, expected models.Versions) *tarantool.CallRequest {
+	var expiresAt, version interface{}
+	if pair.ExpiresAt != 0 {
+		expiresAt = pair.ExpiresAt
+	}
+	if v, ok := expected[pair.Key]; ok {
+		version = v
 	}
+
+	return tarantool.NewCallRequest("kv_put").
+		Context(ctx).
+		Args([]interface{}{pair.Key, pair.Value, expiresAt, version})
 }
@@ -0,0 +1,145 @@
+package tarantool
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"vk-intern/internal/kvstore"
+	"vk-intern/internal/models"
+
+	"github.com/tarantool/go-tarantool/v2"
+)
+
+const (
+	// Сколько записей журнала изменений читается за один запрос
+	changesBatch = 1000
+
+	// Время хранения записей журнала, как CHANGES_TTL в tarantInit.lua
+	changesTTL = 60 * time.Second
+)
+
+// change - кортеж kv_changes
+type change struct {
+	ID        uint64
+	Key       string
+	Value     any
+	Version   uint64
+	Op        string
+	ExpiresAt uint64
+}
+
+// Subscribe возвращает канал событий изменения ключей
+func (t *Tarantool) Subscribe(ctx context.Context) (<-chan *models.Event, error) {
+	const op = "tarantool.Subscribe"
+
+	if t.watcher == nil {
+		return nil, fmt.Errorf("%s: %w", op, kvstore.ErrWatchUnavailable)
+	}
+
+	return t.hub.Subscribe(ctx), nil
+}
+
+// startWatch подписывается на box.broadcast("kv_changes") из tarantInit.lua.
+// Событие содержит только номер последней записи журнала, сами изменения
+// дочитываются в watchChanges, поэтому пропущенные уведомления не теряют событий.
+func (t *Tarantool) startWatch() error {
+	last, err := t.lastChange()
+	if err != nil {
+		return err
+	}
+
+	notify := make(chan struct{}, 1)
+	watcher, err := t.conn.NewWatcher("kv_changes", func(tarantool.WatchEvent) {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	t.watcher = watcher
+	go t.watchChanges(last, notify)
+	return nil
+}
+
+func (t *Tarantool) stopWatch() {
+	if t.watcher != nil {
+		t.watcher.Unregister()
+	}
+	close(t.done)
+	t.hub.Close()
+}
+
+// lastChange возвращает номер последней записи журнала изменений
+func (t *Tarantool) lastChange() (uint64, error) {
+	req := tarantool.NewSelectRequest("kv_changes").
+		Index("primary").
+		Limit(1).
+		Iterator(tarantool.IterLe).
+		Key([]interface{}{})
+
+	changes := []*change{}
+	if err := t.conn.Do(req).GetTyped(&changes); err != nil {
+		return 0, err
+	}
+
+	if len(changes) == 0 {
+		return 0, nil
+	}
+	return changes[0].ID, nil
+}
+
+func (t *Tarantool) watchChanges(last uint64, notify <-chan struct{}) {
+	const op = "tarantool.watchChanges"
+	log := t.log.With(slog.String("op", op))
+
+	// Время последнего успешного чтения журнала
+	readAt := time.Now()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-notify:
+		}
+
+		for {
+			req := tarantool.NewSelectRequest("kv_changes").
+				Index("primary").
+				Limit(changesBatch).
+				Iterator(tarantool.IterGt).
+				Key([]interface{}{last})
+
+			changes := []*change{}
+			if err := t.conn.Do(req).GetTyped(&changes); err != nil {
+				log.Error("Не удалось прочитать журнал изменений", slog.String("error", err.Error()))
+				break
+			}
+
+			// Если журнал не читался дольше времени хранения записей и номера идут с пропуском,
+			// часть записей могла быть удалена до чтения. Номера пропускаются и при откате
+			// транзакций, поэтому пропуск без задержки чтения потерей не считается.
+			// Запас в секунду нужен из-за округления времени истечения до секунд.
+			if len(changes) != 0 && last != 0 && changes[0].ID > last+1 &&
+				time.Since(readAt) >= changesTTL-time.Second {
+				log.Error("Часть журнала изменений удалена до чтения, подписчики отключены",
+					slog.Uint64("last", last), slog.Uint64("next", changes[0].ID))
+				t.hub.Reset()
+			}
+			readAt = time.Now()
+
+			for _, c := range changes {
+				t.hub.Publish(&models.Event{Key: c.Key, Value: c.Value, Version: c.Version, Op: c.Op})
+				last = c.ID
+			}
+
+			if len(changes) < changesBatch {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package tarantool
+
+import (
+	"sync"
+
+	"github.com/tarantool/go-tarantool/v2"
+)
+
+// Число рабочих горутин, как в реализации Read, Write и Delete до pipeline
+const numWorkers = 4
+
+// workers выполняет n запросов request(i) так, как это делалось до pipeline:
+// numWorkers горутин берут индексы из канала и ждут ответа на каждый запрос
+// перед отправкой следующего. Используется только для сравнения в бенчмарках.
+func (t *Tarantool) workers(n int, request func(i int) tarantool.Request) error {
+	indexes := make(chan int)
+	go func() {
+		defer close(indexes)
+		for i := range n {
+			indexes <- i
+		}
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for range numWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if _, err := t.conn.Do(request(i)).Get(); err != nil {
+					once.Do(func() { firstErr = err })
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return firstErr
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "kv"
+
+// Результаты входа для LoginAttempts
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+	LoginLocked  = "locked"
+)
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Число HTTP-запросов по маршруту, методу и коду ответа",
+	}, []string{"route", "method", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Длительность обработки HTTP-запросов",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	TarantoolDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tarantool_call_duration_seconds",
+		Help:      "Длительность операций с Tarantool",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	TarantoolErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tarantool_call_errors_total",
+		Help:      "Число ошибок операций с Tarantool",
+	}, []string{"operation"})
+
+	BatchKeys = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "batch_keys",
+		Help:      "Число ключей в одном запросе",
+		Buckets:   []float64{1, 10, 100, 1000, 10000},
+	}, []string{"operation"})
+
+	LoginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_attempts_total",
+		Help:      "Число попыток входа по результату: success, failure, locked",
+	}, []string{"result"})
+)
+
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		TarantoolDuration,
+		TarantoolErrors,
+		BatchKeys,
+		LoginAttempts,
+	)
+}
+
+// Handler отдает метрики в текстовом формате Prometheus
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveHTTP учитывает обработанный HTTP-запрос
+func ObserveHTTP(route, method string, status int, start time.Time) {
+	code := strconv.Itoa(status)
+	HTTPRequests.WithLabelValues(route, method, code).Inc()
+	HTTPDuration.WithLabelValues(route, method, code).Observe(time.Since(start).Seconds())
+}
+
+// ObserveTarantool учитывает длительность операции с Tarantool и ее ошибку.
+// Вызывается через defer с указателем на возвращаемую ошибку
+func ObserveTarantool(operation string, start time.Time, err *error) {
+	TarantoolDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil && *err != nil {
+		TarantoolErrors.WithLabelValues(operation).Inc()
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+import "strings"
+
+const (
+	subjectUser = "user:"
+	subjectRole = "role:"
+)
+
+// Grant дает субъекту доступ к ключам с префиксом Prefix.
+// Субъект - пользователь (user:<имя>) или роль (role:<роль>).
+// Права роли получают и пользователи со старшими ролями.
+type Grant struct {
+	Subject string `json:"subject" msgpack:"subject"`
+	Prefix  string `json:"prefix" msgpack:"prefix"`
+	Read    bool   `json:"read" msgpack:"read"`
+	Write   bool   `json:"write" msgpack:"write"`
+}
+
+func UserSubject(username string) string {
+	return subjectUser + username
+}
+
+func RoleSubject(role string) string {
+	return subjectRole + role
+}
+
+// ValidSubject проверяет, что субъект указывает на пользователя или существующую роль
+func ValidSubject(subject string) bool {
+	if name, ok := strings.CutPrefix(subject, subjectUser); ok {
+		return name != ""
+	}
+
+	if role, ok := strings.CutPrefix(subject, subjectRole); ok {
+		return ValidRole(role)
+	}
+
+	return false
+}
+
+// api/acl
+type DeleteGrantRequest struct {
+	Subject string `json:"subject"`
+	Prefix  string `json:"prefix"`
+}
+
+type GrantsResponse struct {
+	Grants []*Grant `json:"grants"`
+}
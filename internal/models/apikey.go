@@ -0,0 +1,39 @@
+package models
+
+// api/apikeys
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+	// Роли, доступные по ключу. По умолчанию все роли владельца
+	Roles []string `json:"roles"`
+}
+
+type APIKeyResponse struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name,omitempty"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+	// unix-время в секундах, 0 - ключ еще не использовался
+	CreatedAt uint64 `json:"created_at"`
+	LastUsed  uint64 `json:"last_used"`
+	// Сам ключ возвращается только при создании
+	Key string `json:"key,omitempty"`
+}
+
+type APIKeysResponse struct {
+	Keys []*APIKeyResponse `json:"keys"`
+}
+
+type DeleteAPIKeyResponse struct {
+	ID string `json:"id"`
+}
+
+// tarantool obj. Хранится только хеш ключа
+type APIKey struct {
+	ID        string   `msgpack:"id"`
+	Username  string   `msgpack:"username"`
+	Hash      string   `msgpack:"hash"`
+	Name      string   `msgpack:"name"`
+	Roles     []string `msgpack:"roles"`
+	CreatedAt uint64   `msgpack:"created_at"`
+	LastUsed  uint64   `msgpack:"last_used"`
+}
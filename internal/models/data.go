@@ -1,27 +1,148 @@
 package models
 
+import "time"
+
 type Data map[string]any
 
+// Время жизни ключей, ключи без записи хранятся бессрочно
+type TTL map[string]time.Duration
+
+// Версии ключей. Версия 0 означает, что ключ не существует
+type Versions map[string]uint64
+
 // api/read
 type ReadRequest struct {
 	Keys []string `json:"keys"`
+	// Вернуть 404, если хотя бы одного ключа нет
+	Strict bool `json:"strict,omitempty"`
 }
 
 type ReadResponse struct {
-	Data Data `json:"data"`
+	// Только найденные ключи, значение null означает, что ключ хранит null
+	Data     Data     `json:"data"`
+	Versions Versions `json:"versions"`
+	// Ключи, которых нет в хранилище
+	Missing []string `json:"missing"`
+	// Ключи, к которым у пользователя нет доступа на чтение
+	Denied []string `json:"denied,omitempty"`
+	Error  string   `json:"error,omitempty"`
 }
 
 // api/write
 type WriteRequest struct {
 	Data Data `json:"data"`
+	// Время жизни в секундах для всех ключей запроса
+	TTL int64 `json:"ttl,omitempty"`
+	// Время жизни в секундах для отдельных ключей, имеет приоритет над TTL
+	KeyTTL map[string]int64 `json:"key_ttl,omitempty"`
+	// Запись всех пар в одной транзакции
+	Atomic bool `json:"atomic,omitempty"`
+	// Ожидаемые версии ключей для условной записи (compare-and-swap).
+	// Без BestEffort такая запись всегда выполняется атомарно
+	Versions Versions `json:"versions,omitempty"`
+	// Вернуть результат записи каждого ключа вместо общей ошибки
+	BestEffort bool `json:"best_effort,omitempty"`
+}
+
+const (
+	WriteStatusSuccess    = "success"
+	WriteStatusCommitted  = "committed"
+	WriteStatusRolledBack = "rolled_back"
+	WriteStatusPartial    = "partial"
+)
+
+// Результаты записи отдельных ключей в режиме best_effort
+const (
+	KeyStatusOK    = "ok"
+	KeyStatusError = "error"
+)
+
+type KeyStatus struct {
+	Status  string `json:"status"`
+	Version uint64 `json:"version,omitempty"`
+	// HTTP-код ошибки ключа: 403 - нет доступа, 409 - конфликт версий, 500 - ошибка БД
+	Code  int    `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
 }
 
 type WriteResponse struct {
-	Status string `json:"status"`
+	Status   string   `json:"status"`
+	Versions Versions `json:"versions,omitempty"`
+	// Ключи, к которым у пользователя нет доступа на запись
+	Denied []string `json:"denied,omitempty"`
+	// Результат записи каждого ключа в режиме best_effort
+	Results map[string]*KeyStatus `json:"results,omitempty"`
+	Error   string                `json:"error,omitempty"`
+}
+
+// api/delete
+type DeleteRequest struct {
+	Keys []string `json:"keys"`
+}
+
+type DeleteResponse struct {
+	Deleted []string `json:"deleted"`
+	// Ключи, к которым у пользователя нет доступа на запись
+	Denied []string `json:"denied,omitempty"`
+}
+
+// api/incr
+type IncrRequest struct {
+	// Приращения значений ключей, могут быть отрицательными
+	Deltas map[string]float64 `json:"deltas"`
+}
+
+type IncrResponse struct {
+	// Новые значения ключей
+	Values   map[string]float64 `json:"values"`
+	Versions Versions           `json:"versions"`
+	// Ключи, к которым у пользователя нет доступа на запись
+	Denied []string `json:"denied,omitempty"`
+}
+
+// api/keys/{key}
+// Типы патчей, определяются заголовком Content-Type
+const (
+	PatchTypeMerge = "application/merge-patch+json"
+	PatchTypeJSON  = "application/json-patch+json"
+)
+
+type KeyResponse struct {
+	Key     string `json:"key"`
+	Value   any    `json:"value"`
+	Version uint64 `json:"version"`
+}
+
+// api/keys
+type KeysResponse struct {
+	Keys []string `json:"keys"`
+	// Значения ключей, если запрошены через values=true
+	Data     Data     `json:"data,omitempty"`
+	Versions Versions `json:"versions,omitempty"`
+	// Курсор для следующей страницы, пустой - ключей больше нет
+	Next string `json:"next,omitempty"`
 }
 
 // tarantool obj
 type Pair struct {
 	Key   string `msgpack:"key"`
 	Value any    `msgpack:"value"`
+	// unix-время истечения в секундах, 0 - бессрочно
+	ExpiresAt uint64 `msgpack:"expires_at"`
+	Version   uint64 `msgpack:"version"`
+}
+
+// Операции в событиях api/watch
+const (
+	EventPut    = "put"
+	EventDelete = "delete"
+)
+
+// Event - изменение ключа. Для удаления Value равен nil,
+// а Version - последней версии удаленного ключа
+type Event struct {
+	Key     string `json:"key"`
+	Value   any    `json:"value"`
+	Version uint64 `json:"version"`
+	Op      string `json:"op"`
 }
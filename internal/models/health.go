@@ -0,0 +1,16 @@
+package models
+
+// healthz, readyz
+const (
+	HealthOK          = "ok"
+	HealthUnavailable = "unavailable"
+	HealthShutdown    = "shutting_down"
+	HealthDisconnect  = "disconnected"
+)
+
+type HealthResponse struct {
+	Status string `json:"status"`
+	// Состояние хранилища, только для readyz
+	KVStore string `json:"kvstore,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
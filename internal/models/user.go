@@ -1,15 +1,105 @@
 package models
 
+import (
+	"slices"
+	"time"
+)
+
+// Роли пользователей. Каждая следующая роль включает права предыдущей
+const (
+	RoleReader = "reader"
+	RoleWriter = "writer"
+	RoleAdmin  = "admin"
+)
+
+var roleLevels = map[string]int{
+	RoleReader: 1,
+	RoleWriter: 2,
+	RoleAdmin:  3,
+}
+
+// ValidRole проверяет, что роль существует
+func ValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// HasRole проверяет, что среди ролей есть required или роль старше нее
+func HasRole(roles []string, required string) bool {
+	return slices.ContainsFunc(roles, func(role string) bool {
+		return roleLevels[role] >= roleLevels[required]
+	})
+}
+
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// api/refresh
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// api/logout
+type LogoutRequest struct {
+	// Необязательный токен обновления, который тоже нужно отозвать
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutResponse struct {
+	Status string `json:"status"`
+}
+
+// api/users
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// По умолчанию reader
+	Roles []string `json:"roles"`
+}
+
+// Пустые поля не изменяются
+type UpdateUserRequest struct {
+	Password string   `json:"password"`
+	Roles    []string `json:"roles"`
+}
+
+type UserResponse struct {
+	Username string   `json:"username"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+type UsersResponse struct {
+	Users []*UserResponse `json:"users"`
+}
+
+// LockoutPolicy - ограничение неудачных попыток входа для пользователя или IP-адреса.
+// После каждой неудачи вход блокируется на BaseDelay, удваивая задержку до MaxDelay,
+// а после MaxFailures неудач подряд - на Lockout. Счетчик сбрасывается, если
+// за Window не было новых неудач.
+type LockoutPolicy struct {
+	MaxFailures uint64
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Lockout     time.Duration
+	Window      time.Duration
+}
+
+// IPSubject - субъект счетчика неудачных попыток входа с IP-адреса.
+// Счетчик пользователя использует UserSubject
+func IPSubject(addr string) string {
+	return "ip:" + addr
 }
 
+// tarantool obj
 type User struct {
-	Username string `msgpack:"username"`
-	Password string `msgpack:"password"`
+	Username string   `msgpack:"username"`
+	Password string   `msgpack:"password"`
+	Roles    []string `msgpack:"roles"`
 }
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"vk-intern/internal/kvstore"
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
+)
+
+func (s *Server) listGrants(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.listGrants"
+	log := s.log.With(slog.String("op", op))
+
+	grants, err := s.auth.ListGrants(r.Context())
+	if err != nil {
+		log.Error("Не удалось получить правила доступа",
+			slog.String("error", err.Error()))
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	grantsResp := &models.GrantsResponse{Grants: grants}
+	return writeJSON(w, http.StatusOK, grantsResp)
+}
+
+func (s *Server) putGrant(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.putGrant"
+	log := s.log.With(slog.String("op", op))
+
+	grant := &models.Grant{}
+	log.Info("Преобразование запроса в объект")
+	if err := json.NewDecoder(r.Body).Decode(grant); err != nil {
+		log.Error("Не удалось преобразовать запрос в объект",
+			slog.String("error", err.Error()))
+		return decodeErr(r, err, ErrBadReq)
+	}
+	defer r.Body.Close()
+
+	if err := s.auth.PutGrant(r.Context(), grant); err != nil {
+		log.Error("Не удалось сохранить правило доступа",
+			slog.String("error", err.Error()))
+		if errors.Is(err, services.ErrBadSubject) {
+			return writeErr(r, http.StatusBadRequest, services.ErrBadSubject)
+		}
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	return writeJSON(w, http.StatusOK, grant)
+}
+
+func (s *Server) deleteGrant(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.deleteGrant"
+	log := s.log.With(slog.String("op", op))
+
+	deleteReq := &models.DeleteGrantRequest{}
+	log.Info("Преобразование запроса в объект")
+	if err := json.NewDecoder(r.Body).Decode(deleteReq); err != nil {
+		log.Error("Не удалось преобразовать запрос в объект",
+			slog.String("error", err.Error()))
+		return decodeErr(r, err, ErrBadReq)
+	}
+	defer r.Body.Close()
+
+	if deleteReq.Subject == "" {
+		log.Error("Не указан субъект")
+		return writeErr(r, http.StatusBadRequest, services.ErrBadSubject)
+	}
+
+	if err := s.auth.DeleteGrant(r.Context(), deleteReq.Subject, deleteReq.Prefix); err != nil {
+		log.Error("Не удалось удалить правило доступа",
+			slog.String("error", err.Error()))
+		if errors.Is(err, kvstore.ErrGrantNotFound) {
+			return writeErr(r, http.StatusNotFound, kvstore.ErrGrantNotFound)
+		}
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	grantResp := &models.Grant{Subject: deleteReq.Subject, Prefix: deleteReq.Prefix}
+	return writeJSON(w, http.StatusOK, grantResp)
+}
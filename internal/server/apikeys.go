@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"vk-intern/internal/kvstore"
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
+)
+
+func (s *Server) createAPIKey(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.createAPIKey"
+	log := s.log.With(slog.String("op", op))
+
+	// Тело необязательно, без него ключ получает все роли пользователя
+	createReq := &models.CreateAPIKeyRequest{}
+	log.Info("Преобразование запроса в объект")
+	if err := json.NewDecoder(r.Body).Decode(createReq); err != nil && !errors.Is(err, io.EOF) {
+		log.Error("Не удалось преобразовать запрос в объект",
+			slog.String("error", err.Error()))
+		return decodeErr(r, err, ErrBadReq)
+	}
+	defer r.Body.Close()
+
+	key, apiKey, err := s.auth.CreateAPIKey(r.Context(),
+		services.IdentityFromContext(r.Context()), createReq.Name, createReq.Roles,
+	)
+	if err != nil {
+		log.Error("Не удалось создать API-ключ",
+			slog.String("error", err.Error()))
+		if errors.Is(err, services.ErrBadRole) {
+			return writeErr(r, http.StatusBadRequest, services.ErrBadRole)
+		}
+		if errors.Is(err, services.ErrRoleNotAllowed) {
+			return writeErr(r, http.StatusForbidden, services.ErrRoleNotAllowed)
+		}
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	keyResp := apiKeyResponse(key)
+	keyResp.Key = apiKey
+	return writeJSON(w, http.StatusCreated, keyResp)
+}
+
+// listAPIKeys возвращает ключи пользователя запроса.
+// Администратор может получить ключи другого пользователя через ?username=
+// или всех пользователей через ?username=*
+func (s *Server) listAPIKeys(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.listAPIKeys"
+	log := s.log.With(slog.String("op", op))
+
+	identity := services.IdentityFromContext(r.Context())
+	username := identity.Username
+	if u := r.URL.Query().Get("username"); u != "" && u != username {
+		if !models.HasRole(identity.Roles, models.RoleAdmin) {
+			log.Error("Недостаточно прав для просмотра чужих ключей")
+			return writeErr(r, http.StatusForbidden, ErrForbidden)
+		}
+
+		username = u
+		if u == "*" {
+			username = ""
+		}
+	}
+
+	keys, err := s.auth.ListAPIKeys(r.Context(), username)
+	if err != nil {
+		log.Error("Не удалось получить API-ключи",
+			slog.String("error", err.Error()))
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	keysResp := &models.APIKeysResponse{Keys: make([]*models.APIKeyResponse, 0, len(keys))}
+	for _, key := range keys {
+		keysResp.Keys = append(keysResp.Keys, apiKeyResponse(key))
+	}
+	return writeJSON(w, http.StatusOK, keysResp)
+}
+
+func (s *Server) deleteAPIKey(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.deleteAPIKey"
+	log := s.log.With(slog.String("op", op))
+
+	id := r.PathValue("id")
+
+	if err := s.auth.DeleteAPIKey(r.Context(),
+		services.IdentityFromContext(r.Context()), id,
+	); err != nil {
+		log.Error("Не удалось удалить API-ключ",
+			slog.String("error", err.Error()))
+		if errors.Is(err, kvstore.ErrAPIKeyNotFound) {
+			return writeErr(r, http.StatusNotFound, kvstore.ErrAPIKeyNotFound)
+		}
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	keyResp := &models.DeleteAPIKeyResponse{ID: id}
+	return writeJSON(w, http.StatusOK, keyResp)
+}
+
+func apiKeyResponse(key *models.APIKey) *models.APIKeyResponse {
+	return &models.APIKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Username:  key.Username,
+		Roles:     key.Roles,
+		CreatedAt: key.CreatedAt,
+		LastUsed:  key.LastUsed,
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
+)
+
+// etag строится из версии и хеша значения ключа. Хеш отличает значения
+// с одинаковой версией, если хранилище восстановлено из старой копии.
+func etag(version uint64, value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf(`"%d"`, version)
+	}
+
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf(`"%d-%s"`, version, hex.EncodeToString(sum[:8]))
+}
+
+// matchETag проверяет, что тег есть в списке из заголовка If-Match или If-None-Match.
+// При слабом сравнении (If-None-Match) префикс W/ не учитывается,
+// при строгом (If-Match) слабые теги не совпадают ни с чем.
+func matchETag(header, tag string, weak bool) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" {
+			return true
+		}
+
+		if strings.HasPrefix(t, "W/") {
+			if !weak {
+				continue
+			}
+			t = t[2:]
+		}
+
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatchVersion проверяет заголовок If-Match по текущему значению ключа и возвращает
+// версию, с которой должна выполняться запись. Без заголовка возвращается 0.
+func (s *Server) ifMatchVersion(r *http.Request, key string) (uint64, error) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, nil
+	}
+
+	pair, err := s.storage.Get(r.Context(), s.cfg.Server.Timeout, key)
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			return 0, ErrPrecondition
+		}
+		return 0, err
+	}
+
+	if !matchETag(header, etag(pair.Version, pair.Value), false) {
+		return 0, ErrPrecondition
+	}
+
+	return pair.Version, nil
+}
+
+// writeKey отдает значение ключа вместе с заголовком ETag
+func writeKey(w http.ResponseWriter, status int, pair *models.Pair) error {
+	w.Header().Set("ETag", etag(pair.Version, pair.Value))
+	keyResp := &models.KeyResponse{Key: pair.Key, Value: pair.Value, Version: pair.Version}
+	return writeJSON(w, status, keyResp)
+}
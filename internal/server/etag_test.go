@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestMatchETag(t *testing.T) {
+	const tag = `"3-0123456789abcdef"`
+
+	tests := []struct {
+		name   string
+		header string
+		weak   bool
+		want   bool
+	}{
+		{name: "совпадение", header: tag, want: true},
+		{name: "другой тег", header: `"3-ffffffffffffffff"`, want: false},
+		{name: "звездочка", header: "*", want: true},
+		{name: "список", header: `"1-aa", ` + tag + `, "2-bb"`, want: true},
+		{name: "список без совпадений", header: `"1-aa","2-bb"`, want: false},
+		{name: "без кавычек", header: "3-0123456789abcdef", want: false},
+		{name: "слабый тег при строгом сравнении", header: "W/" + tag, weak: false, want: false},
+		{name: "слабый тег при слабом сравнении", header: "W/" + tag, weak: true, want: true},
+		{name: "слабый тег в списке", header: `"1-aa", W/` + tag, weak: true, want: true},
+		{name: "пустой заголовок", header: "", weak: true, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := matchETag(tt.header, tag, tt.weak); got != tt.want {
+			t.Errorf("%s: matchETag(%q, weak=%v) = %v, want %v", tt.name, tt.header, tt.weak, got, tt.want)
+		}
+	}
+}
+
+func TestETag(t *testing.T) {
+	a := etag(1, map[string]any{"a": 1})
+
+	if got := etag(1, map[string]any{"a": 1}); got != a {
+		t.Errorf("тег одного значения изменился: %s != %s", got, a)
+	}
+	if got := etag(2, map[string]any{"a": 1}); got == a {
+		t.Errorf("тег не зависит от версии: %s", got)
+	}
+	if got := etag(1, map[string]any{"a": 2}); got == a {
+		t.Errorf("тег не зависит от значения: %s", got)
+	}
+	if !matchETag(a, a, false) {
+		t.Errorf("тег %s не совпадает сам с собой", a)
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"vk-intern/internal/kvstore"
+	"vk-intern/internal/models"
+)
+
+// Время ожидания ответа хранилища в /readyz
+const readyTimeout = time.Second
+
+// healthz отвечает, пока процесс жив, и не обращается к хранилищу
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) error {
+	return writeJSON(w, http.StatusOK, models.HealthResponse{Status: models.HealthOK})
+}
+
+// readyz отвечает 503, если хранилище недоступно или сервер останавливается
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.readyz"
+	log := s.log.With(slog.String("op", op))
+
+	if !s.ready.Load() {
+		return writeJSON(w, http.StatusServiceUnavailable, models.HealthResponse{Status: models.HealthShutdown})
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	if err := s.health.Ping(ctx); err != nil {
+		log.Error("Хранилище не готово к работе", slog.String("error", err.Error()))
+
+		state := models.HealthUnavailable
+		if errors.Is(err, kvstore.ErrNotConnected) {
+			state = models.HealthDisconnect
+		}
+		return writeJSON(w, http.StatusServiceUnavailable, models.HealthResponse{
+			Status:  models.HealthUnavailable,
+			KVStore: state,
+			Error:   err.Error(),
+		})
+	}
+
+	return writeJSON(w, http.StatusOK, models.HealthResponse{
+		Status:  models.HealthOK,
+		KVStore: models.HealthOK,
+	})
+}
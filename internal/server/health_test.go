@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"vk-intern/internal/config"
+	"vk-intern/internal/models"
+)
+
+func TestHealth(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+
+	resp, body := ts.do(t, "", http.MethodGet, "/healthz", nil, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+
+	resp, body = ts.do(t, "", http.MethodGet, "/readyz", nil, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	health := &models.HealthResponse{}
+	decode(t, body, health)
+	if health.KVStore != models.HealthOK {
+		t.Errorf("состояние хранилища %q, want %q", health.KVStore, models.HealthOK)
+	}
+
+	// При остановке сервер выходит из балансировки, но процесс жив
+	ts.server.ready.Store(false)
+
+	resp, body = ts.do(t, "", http.MethodGet, "/readyz", nil, nil)
+	wantStatus(t, resp, body, http.StatusServiceUnavailable)
+	decode(t, body, health)
+	if health.Status != models.HealthShutdown {
+		t.Errorf("статус %q, want %q", health.Status, models.HealthShutdown)
+	}
+
+	resp, body = ts.do(t, "", http.MethodGet, "/healthz", nil, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+}
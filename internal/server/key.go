@@ -0,0 +1,233 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
+)
+
+// getKey возвращает значение и версию одного ключа.
+// Если ETag совпадает с If-None-Match, возвращается 304 без тела.
+func (s *Server) getKey(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.getKey"
+	key := r.PathValue("key")
+	log := s.log.With(slog.String("op", op), slog.String("key", key))
+
+	pair, err := s.storage.Get(r.Context(), s.cfg.Server.Timeout, key)
+	if err != nil {
+		log.Error("Не удалось прочитать ключ",
+			slog.String("error", err.Error()))
+		return keyErr(r, err)
+	}
+
+	tag := etag(pair.Version, pair.Value)
+	if header := r.Header.Get("If-None-Match"); header != "" && matchETag(header, tag, true) {
+		log.Info("Значение ключа не изменилось")
+		w.Header().Set("ETag", tag)
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	return writeKey(w, http.StatusOK, pair)
+}
+
+// putKey записывает значение ключа из тела запроса.
+// Время жизни в секундах передается параметром ttl.
+// С If-Match ключ записывается, только если его ETag совпадает,
+// с If-None-Match: * - только если ключа еще нет.
+func (s *Server) putKey(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.putKey"
+	key := r.PathValue("key")
+	log := s.log.With(slog.String("op", op), slog.String("key", key))
+
+	ttl := models.TTL{}
+	if t := r.URL.Query().Get("ttl"); t != "" {
+		sec, err := strconv.ParseInt(t, 10, 64)
+		if err != nil || sec < 0 {
+			log.Error("Некорректное время жизни ключа", slog.String("ttl", t))
+			return writeErr(r, http.StatusBadRequest, ErrBadTTL)
+		}
+		if sec > 0 {
+			ttl[key] = time.Duration(sec) * time.Second
+		}
+	}
+
+	var value any
+	log.Info("Преобразование запроса в объект")
+	if err := json.NewDecoder(r.Body).Decode(&value); err != nil {
+		log.Error("Не удалось преобразовать запрос в объект",
+			slog.String("error", err.Error()))
+		return decodeErr(r, err, ErrBadReq)
+	}
+	defer r.Body.Close()
+
+	if err := s.checkData(r, models.Data{key: value}); err != nil {
+		log.Error("Запрос превышает ограничения", slog.String("error", err.Error()))
+		return err
+	}
+
+	var expected models.Versions
+	if r.Header.Get("If-None-Match") == "*" {
+		expected = models.Versions{key: 0}
+	}
+
+	version, err := s.ifMatchVersion(r, key)
+	if err != nil {
+		log.Error("Условие записи не выполнено",
+			slog.String("error", err.Error()))
+		return keyErr(r, err)
+	}
+	if version != 0 {
+		expected = models.Versions{key: version}
+	}
+
+	versions, failed, denied, err := s.storage.Write(r.Context(),
+		s.cfg.Server.Timeout, models.Data{key: value}, ttl, expected,
+	)
+	if err == nil {
+		err = failed[key]
+	}
+	if err != nil {
+		log.Error("Не удалось записать ключ",
+			slog.String("error", err.Error()))
+		if errors.Is(err, services.ErrConflict) {
+			return writeErr(r, http.StatusPreconditionFailed, ErrPrecondition)
+		}
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	if len(denied) != 0 {
+		log.Error("Нет доступа к ключу")
+		return writeErr(r, http.StatusForbidden, services.ErrAccessDenied)
+	}
+
+	return writeKey(w, http.StatusCreated, &models.Pair{Key: key, Value: value, Version: versions[key]})
+}
+
+// deleteKey удаляет один ключ. С If-Match ключ удаляется, только если его ETag совпадает.
+func (s *Server) deleteKey(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.deleteKey"
+	key := r.PathValue("key")
+	log := s.log.With(slog.String("op", op), slog.String("key", key))
+
+	version, err := s.ifMatchVersion(r, key)
+	if err != nil {
+		log.Error("Условие удаления не выполнено",
+			slog.String("error", err.Error()))
+		return keyErr(r, err)
+	}
+
+	if version != 0 {
+		if err := s.storage.DeleteVersion(r.Context(), s.cfg.Server.Timeout, key, version); err != nil {
+			log.Error("Не удалось удалить ключ",
+				slog.String("error", err.Error()))
+			if errors.Is(err, services.ErrConflict) {
+				return writeErr(r, http.StatusPreconditionFailed, ErrPrecondition)
+			}
+			return keyErr(r, err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	deleted, denied, err := s.storage.Delete(r.Context(), s.cfg.Server.Timeout, []string{key})
+	if err != nil {
+		log.Error("Не удалось удалить ключ",
+			slog.String("error", err.Error()))
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	if len(denied) != 0 {
+		log.Error("Нет доступа к ключу")
+		return writeErr(r, http.StatusForbidden, services.ErrAccessDenied)
+	}
+
+	if len(deleted) == 0 {
+		log.Info("Ключ не найден")
+		return writeErr(r, http.StatusNotFound, services.ErrNotFound)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// patchKey применяет к значению ключа патч из тела запроса.
+// Тип патча задается заголовком Content-Type.
+func (s *Server) patchKey(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.patchKey"
+	key := r.PathValue("key")
+	log := s.log.With(slog.String("op", op), slog.String("key", key))
+
+	patchType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (patchType != models.PatchTypeMerge && patchType != models.PatchTypeJSON) {
+		log.Error("Неподдерживаемый тип патча",
+			slog.String("content_type", r.Header.Get("Content-Type")))
+		return writeErr(r, http.StatusUnsupportedMediaType, ErrPatchType)
+	}
+
+	if err := s.checkKey(r, key); err != nil {
+		log.Error("Запрос превышает ограничения", slog.String("error", err.Error()))
+		return err
+	}
+
+	log.Info("Чтение патча")
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Error("Не удалось прочитать тело запроса",
+			slog.String("error", err.Error()))
+		return decodeErr(r, err, ErrBadReq)
+	}
+	defer r.Body.Close()
+
+	version, err := s.ifMatchVersion(r, key)
+	if err != nil {
+		log.Error("Условие изменения не выполнено",
+			slog.String("error", err.Error()))
+		return keyErr(r, err)
+	}
+
+	pair, err := s.storage.Patch(r.Context(), s.cfg.Server.Timeout, key, patchType, patch, version,
+		s.cfg.Server.Limits.MaxValueSize)
+	if err != nil {
+		log.Error("Не удалось применить патч",
+			slog.String("error", err.Error()))
+
+		switch {
+		case errors.Is(err, services.ErrBadPatch):
+			return writeErr(r, http.StatusBadRequest, services.ErrBadPatch)
+		case errors.Is(err, services.ErrPatchFailed):
+			return writeErr(r, http.StatusConflict, services.ErrPatchFailed)
+		case errors.Is(err, services.ErrValueTooLarge):
+			return writeErr(r, http.StatusRequestEntityTooLarge, services.ErrValueTooLarge)
+		case errors.Is(err, services.ErrConflict) && version != 0:
+			return writeErr(r, http.StatusPreconditionFailed, ErrPrecondition)
+		case errors.Is(err, services.ErrConflict):
+			return writeErr(r, http.StatusConflict, services.ErrConflict)
+		}
+		return keyErr(r, err)
+	}
+
+	return writeKey(w, http.StatusOK, pair)
+}
+
+// keyErr выбирает код ответа для ошибок запросов к одному ключу
+func keyErr(r *http.Request, err error) error {
+	switch {
+	case errors.Is(err, ErrPrecondition):
+		return writeErr(r, http.StatusPreconditionFailed, ErrPrecondition)
+	case errors.Is(err, services.ErrAccessDenied):
+		return writeErr(r, http.StatusForbidden, services.ErrAccessDenied)
+	case errors.Is(err, services.ErrNotFound):
+		return writeErr(r, http.StatusNotFound, services.ErrNotFound)
+	}
+	return writeErr(r, http.StatusInternalServerError, err)
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"vk-intern/internal/config"
+	"vk-intern/internal/models"
+)
+
+func TestPatchKey(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+	merge := map[string]string{"Content-Type": models.PatchTypeMerge}
+	jsonPatch := map[string]string{"Content-Type": models.PatchTypeJSON}
+
+	resp, body := ts.admin(t, http.MethodPatch, "/api/keys/none", `{"a": 1}`, merge)
+	wantStatus(t, resp, body, http.StatusNotFound)
+
+	resp, body = ts.admin(t, http.MethodPut, "/api/keys/doc?ttl=60", `{"a": 1, "list": [1]}`, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+	tag := resp.Header.Get("ETag")
+
+	resp, body = ts.admin(t, http.MethodPatch, "/api/keys/doc", `{"b": 2}`, merge)
+	wantStatus(t, resp, body, http.StatusOK)
+	patched := &models.KeyResponse{}
+	decode(t, body, patched)
+	if want := map[string]any{"a": 1.0, "b": 2.0, "list": []any{1.0}}; !equalJSON(patched.Value, want) {
+		t.Errorf("после merge patch %v, want %v", patched.Value, want)
+	}
+
+	resp, body = ts.admin(t, http.MethodPatch, "/api/keys/doc", `[{"op": "add", "path": "/list/-", "value": 2}]`, jsonPatch)
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, patched)
+	if want := map[string]any{"a": 1.0, "b": 2.0, "list": []any{1.0, 2.0}}; !equalJSON(patched.Value, want) {
+		t.Errorf("после json patch %v, want %v", patched.Value, want)
+	}
+
+	tests := []struct {
+		name   string
+		patch  string
+		header map[string]string
+		status int
+	}{
+		{name: "некорректный патч", patch: `{"a": `, header: merge, status: http.StatusBadRequest},
+		{name: "не выполнена проверка test", patch: `[{"op": "test", "path": "/a", "value": 5}]`, header: jsonPatch, status: http.StatusConflict},
+		{name: "устаревший If-Match", patch: `{"c": 3}`, header: map[string]string{
+			"Content-Type": models.PatchTypeMerge, "If-Match": tag,
+		}, status: http.StatusPreconditionFailed},
+		{name: "неизвестный тип", patch: `{}`, header: map[string]string{"Content-Type": "application/json"}, status: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		resp, body := ts.admin(t, http.MethodPatch, "/api/keys/doc", tt.patch, tt.header)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: код %d, want %d: %s", tt.name, resp.StatusCode, tt.status, body)
+		}
+	}
+
+	// Merge patch к null применяется к пустому объекту, json patch - к самому null
+	resp, body = ts.admin(t, http.MethodPut, "/api/keys/null", `null`, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	resp, body = ts.admin(t, http.MethodPatch, "/api/keys/null", `[{"op": "add", "path": "/a", "value": 1}]`, jsonPatch)
+	wantStatus(t, resp, body, http.StatusConflict)
+
+	resp, body = ts.admin(t, http.MethodPatch, "/api/keys/null", `{"a": 1}`, merge)
+	wantStatus(t, resp, body, http.StatusOK)
+	decode(t, body, patched)
+	if want := map[string]any{"a": 1.0}; !equalJSON(patched.Value, want) {
+		t.Errorf("merge patch к null %v, want %v", patched.Value, want)
+	}
+}
+
+func TestKeyRoutes(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+	path := "/api/keys/" + url.PathEscape("dir/a")
+
+	resp, body := ts.admin(t, http.MethodGet, path, nil, nil)
+	wantStatus(t, resp, body, http.StatusNotFound)
+
+	resp, body = ts.admin(t, http.MethodPut, path, `{"a": 1, "b": {"c": 2}}`, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+	created := &models.KeyResponse{}
+	decode(t, body, created)
+	if created.Key != "dir/a" || created.Version == 0 {
+		t.Fatalf("PUT: %s", body)
+	}
+
+	resp, body = ts.admin(t, http.MethodGet, path, nil, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	got := &models.KeyResponse{}
+	decode(t, body, got)
+	if want := map[string]any{"a": 1.0, "b": map[string]any{"c": 2.0}}; !equalJSON(got.Value, want) || got.Version != created.Version {
+		t.Errorf("GET: %s", body)
+	}
+
+	resp, body = ts.admin(t, http.MethodPut, path+"?ttl=-1", `1`, nil)
+	wantStatus(t, resp, body, http.StatusBadRequest)
+
+	resp, body = ts.admin(t, http.MethodPut, path, `{"a": `, nil)
+	wantStatus(t, resp, body, http.StatusBadRequest)
+
+	resp, body = ts.admin(t, http.MethodDelete, path, nil, nil)
+	wantStatus(t, resp, body, http.StatusNoContent)
+
+	resp, body = ts.admin(t, http.MethodDelete, path, nil, nil)
+	wantStatus(t, resp, body, http.StatusNotFound)
+}
+
+func TestKeyETag(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+
+	resp, body := ts.admin(t, http.MethodPut, "/api/keys/a", `1`, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	resp, body = ts.admin(t, http.MethodGet, "/api/keys/a", nil, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	tag := resp.Header.Get("ETag")
+	if tag == "" {
+		t.Fatal("GET без ETag")
+	}
+
+	resp, body = ts.admin(t, http.MethodGet, "/api/keys/a", nil, map[string]string{"If-None-Match": "W/" + tag})
+	wantStatus(t, resp, body, http.StatusNotModified)
+
+	// Повторное создание с If-None-Match: * запрещено
+	resp, body = ts.admin(t, http.MethodPut, "/api/keys/a", `2`, map[string]string{"If-None-Match": "*"})
+	wantStatus(t, resp, body, http.StatusPreconditionFailed)
+
+	resp, body = ts.admin(t, http.MethodPut, "/api/keys/a", `2`, map[string]string{"If-Match": tag})
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	// Тег устарел после записи
+	resp, body = ts.admin(t, http.MethodGet, "/api/keys/a", nil, map[string]string{"If-None-Match": tag})
+	wantStatus(t, resp, body, http.StatusOK)
+	current := resp.Header.Get("ETag")
+
+	resp, body = ts.admin(t, http.MethodDelete, "/api/keys/a", nil, map[string]string{"If-Match": tag})
+	wantStatus(t, resp, body, http.StatusPreconditionFailed)
+
+	resp, body = ts.admin(t, http.MethodDelete, "/api/keys/a", nil, map[string]string{"If-Match": current})
+	wantStatus(t, resp, body, http.StatusNoContent)
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
+)
+
+// withBodyLimit ограничивает размер тела всех запросов.
+// Ошибку чтения слишком большого тела обрабатывает decodeErr.
+func (s *Server) withBodyLimit(next http.Handler) http.Handler {
+	limit := s.cfg.Server.Limits.MaxBodySize
+	if limit <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			writeJSON(w, http.StatusRequestEntityTooLarge, errResp{Error: ErrBodyTooLarge.Error()})
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkKeys проверяет число ключей в запросе и длину каждого ключа
+func (s *Server) checkKeys(r *http.Request, keys []string) error {
+	limits := s.cfg.Server.Limits
+	if limits.MaxKeys > 0 && len(keys) > limits.MaxKeys {
+		return writeErr(r, http.StatusRequestEntityTooLarge, ErrTooManyKeys)
+	}
+
+	for _, key := range keys {
+		if err := s.checkKey(r, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) checkKey(r *http.Request, key string) error {
+	if limit := s.cfg.Server.Limits.MaxKeyLength; limit > 0 && len(key) > limit {
+		return writeErr(r, http.StatusBadRequest, ErrKeyTooLong)
+	}
+
+	return nil
+}
+
+// checkData проверяет ключи и размер JSON-представления каждого значения
+func (s *Server) checkData(r *http.Request, data models.Data) error {
+	if err := s.checkKeys(r, mapKeys(data)); err != nil {
+		return err
+	}
+
+	for _, value := range data {
+		if err := s.checkValue(r, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) checkValue(r *http.Request, value any) error {
+	limit := s.cfg.Server.Limits.MaxValueSize
+	if limit <= 0 {
+		return nil
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return writeErr(r, http.StatusBadRequest, ErrBadReq)
+	}
+	if len(encoded) > limit {
+		return writeErr(r, http.StatusRequestEntityTooLarge, services.ErrValueTooLarge)
+	}
+
+	return nil
+}
+
+func mapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"vk-intern/internal/config"
+	"vk-intern/internal/models"
+)
+
+func TestLimits(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{
+		MaxKeys:      2,
+		MaxKeyLength: 8,
+		MaxValueSize: 32,
+		MaxBodySize:  1024,
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		header map[string]string
+		status int
+	}{
+		{
+			name: "много ключей", method: http.MethodPost, path: "/api/read",
+			body: models.ReadRequest{Keys: []string{"a", "b", "c"}}, status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "длинный ключ", method: http.MethodPost, path: "/api/write",
+			body: models.WriteRequest{Data: models.Data{"very-long-key": 1}}, status: http.StatusBadRequest,
+		},
+		{
+			name: "большое значение", method: http.MethodPost, path: "/api/write",
+			body: models.WriteRequest{Data: models.Data{"a": strings.Repeat("x", 40)}}, status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "большое тело", method: http.MethodPost, path: "/api/write",
+			body: `{"data": {"a": "` + strings.Repeat("x", 2048) + `"}}`, status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "много ключей в watch", method: http.MethodGet, path: "/api/watch?keys=a,b,c",
+			status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "длинный ключ в пути", method: http.MethodPut, path: "/api/keys/very-long-key",
+			body: `1`, status: http.StatusBadRequest,
+		},
+		{
+			name: "длинный префикс в списке ключей", method: http.MethodGet, path: "/api/keys?prefix=very-long-key",
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "длинный курсор в списке ключей", method: http.MethodGet, path: "/api/keys?after=very-long-key",
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "длинный префикс в watch", method: http.MethodGet, path: "/api/watch?prefix=very-long-key",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		resp, body := ts.admin(t, tt.method, tt.path, tt.body, tt.header)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: код %d, want %d: %s", tt.name, resp.StatusCode, tt.status, body)
+		}
+	}
+
+	// Патч, который увеличивает значение сверх ограничения, не записывается
+	resp, body := ts.admin(t, http.MethodPut, "/api/keys/a", `{"x": "0123456789"}`, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	patch := `[{"op": "copy", "from": "/x", "path": "/y"}]`
+	header := map[string]string{"Content-Type": models.PatchTypeJSON}
+	resp, body = ts.admin(t, http.MethodPatch, "/api/keys/a", patch, header)
+	wantStatus(t, resp, body, http.StatusRequestEntityTooLarge)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"vk-intern/internal/metrics"
+)
+
+// statusWriter запоминает код ответа для метрик
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush нужен для потоков api/watch
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withMetrics учитывает число и длительность запросов по шаблону маршрута router
+func (s *Server) withMetrics(router *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// Шаблон, а не путь, чтобы ключи и имена пользователей не попадали в метки
+		_, route := router.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		metrics.ObserveHTTP(route, r.Method, status, start)
+	})
+}
@@ -1,44 +1,123 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
 
 	"vk-intern/internal/jwt"
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
 )
 
+type ctxKey int
+
+const ctxKeyClaims ctxKey = iota
+
+// claimsFromContext возвращает данные токена доступа, проверенного в withAuth
+func claimsFromContext(ctx context.Context) *jwt.Claims {
+	claims, _ := ctx.Value(ctxKeyClaims).(*jwt.Claims)
+	return claims
+}
+
+// withContext вызывает f с запросом, в котором заменен контекст.
+// writeErr сохраняет код ответа в переданном запросе, поэтому он
+// переносится обратно в исходный запрос для handleFunc.
+func withContext(ctx context.Context, f handlerFunc) handlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		req := r.WithContext(ctx)
+		err := f(w, req)
+		r.Response = req.Response
+		return err
+	}
+}
+
 func (s *Server) withAuth(f handlerFunc) handlerFunc {
 	const op = "server.withLogin"
 	log := s.log.With(slog.String("op", op))
 
 	return func(w http.ResponseWriter, r *http.Request) error {
+		if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+			return s.withAPIKey(apiKey, f)(w, r)
+		}
+
 		auth := r.Header.Get("Authorization")
 		if auth == "" {
 			log.Error("Нет заголовка авторизации")
 			return writeErr(r, http.StatusUnauthorized, ErrUnauth)
 		}
 
-		token := strings.Split(auth, " ")[1]
-		if token == "" {
+		token, _ := strings.CutPrefix(auth, "Bearer ")
+		if token == "" || token == auth {
 			log.Error("Нет токена авторизации")
 			return writeErr(r, http.StatusUnauthorized, ErrUnauth)
 		}
 
 		log.Info("Проверка токена")
-		username, err := jwt.ParseJWT(token, s.cfg.Secret)
+		claims, err := s.auth.ParseToken(r.Context(), s.jwtKeys, token, jwt.TypeAccess)
 		if err != nil {
 			log.Error("Ошибка проверки токена", slog.String("error", err.Error()))
 			return writeErr(r, http.StatusUnauthorized, ErrUnauth)
 		}
+		username := claims.Username
 		log.Info("Токен проверен", slog.String("username", username))
 
-		if err := s.auth.FindUser(r.Context(), username); err != nil {
+		// Роли берутся из базы, а не из токена, чтобы изменение ролей
+		// действовало сразу, а не после истечения выданных токенов
+		roles, err := s.auth.FindUser(r.Context(), username)
+		if err != nil {
 			log.Error("Пользователь не найден", slog.String("error", err.Error()))
+			if errors.Is(err, services.ErrInternal) {
+				return writeErr(r, http.StatusInternalServerError, services.ErrInternal)
+			}
 			return writeErr(r, http.StatusUnauthorized, ErrUnauth)
 		}
 
 		log.Info("User authorized")
-		return f(w, r)
+		ctx := services.WithIdentity(r.Context(),
+			&services.Identity{Username: username, Roles: roles})
+		ctx = context.WithValue(ctx, ctxKeyClaims, claims)
+		return withContext(ctx, f)(w, r)
 	}
 }
+
+// withAPIKey авторизует запрос по API-ключу вместо токена доступа
+func (s *Server) withAPIKey(apiKey string, f handlerFunc) handlerFunc {
+	const op = "server.withAPIKey"
+	log := s.log.With(slog.String("op", op))
+
+	return func(w http.ResponseWriter, r *http.Request) error {
+		log.Info("Проверка API-ключа")
+		identity, err := s.auth.CheckAPIKey(r.Context(), apiKey)
+		if err != nil {
+			log.Error("Ошибка проверки API-ключа", slog.String("error", err.Error()))
+			if errors.Is(err, services.ErrInternal) {
+				return writeErr(r, http.StatusInternalServerError, services.ErrInternal)
+			}
+			return writeErr(r, http.StatusUnauthorized, ErrUnauth)
+		}
+
+		log.Info("User authorized", slog.String("username", identity.Username))
+		ctx := services.WithIdentity(r.Context(), identity)
+		return withContext(ctx, f)(w, r)
+	}
+}
+
+// withRole пропускает только пользователей, у которых есть роль role или старше
+func (s *Server) withRole(role string, f handlerFunc) handlerFunc {
+	const op = "server.withRole"
+	log := s.log.With(slog.String("op", op))
+
+	return s.withAuth(func(w http.ResponseWriter, r *http.Request) error {
+		identity := services.IdentityFromContext(r.Context())
+		if !models.HasRole(identity.Roles, role) {
+			log.Error("Недостаточно прав",
+				slog.String("username", identity.Username), slog.String("role", role))
+			return writeErr(r, http.StatusForbidden, ErrForbidden)
+		}
+
+		return f(w, r)
+	})
+}
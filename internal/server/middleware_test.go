@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"vk-intern/internal/config"
+	"vk-intern/internal/models"
+)
+
+func TestRoles(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+
+	resp, body := ts.admin(t, http.MethodPost, "/api/users", models.CreateUserRequest{
+		Username: "reader", Password: "secret", Roles: []string{models.RoleReader},
+	}, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+	reader := ts.login(t, "reader", "secret")
+
+	resp, body = ts.do(t, reader, http.MethodGet, "/api/keys/a", nil, nil)
+	wantStatus(t, resp, body, http.StatusNotFound)
+
+	resp, body = ts.do(t, reader, http.MethodPut, "/api/keys/a", `1`, nil)
+	wantStatus(t, resp, body, http.StatusForbidden)
+
+	resp, body = ts.do(t, reader, http.MethodGet, "/api/users", nil, nil)
+	wantStatus(t, resp, body, http.StatusForbidden)
+
+	resp, body = ts.do(t, "", http.MethodGet, "/api/keys/a", nil, nil)
+	wantStatus(t, resp, body, http.StatusUnauthorized)
+
+	// Роли берутся из базы, поэтому новая роль действует с прежним токеном
+	resp, body = ts.admin(t, http.MethodPut, "/api/users/reader", models.UpdateUserRequest{
+		Roles: []string{models.RoleWriter},
+	}, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+
+	resp, body = ts.do(t, reader, http.MethodPut, "/api/keys/a", `1`, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	// Токен удаленного пользователя не принимается
+	resp, body = ts.admin(t, http.MethodDelete, "/api/users/reader", nil, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+
+	resp, body = ts.do(t, reader, http.MethodGet, "/api/keys/a", nil, nil)
+	wantStatus(t, resp, body, http.StatusUnauthorized)
+}
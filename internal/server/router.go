@@ -3,23 +3,66 @@ package server
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
+	"vk-intern/internal/metrics"
 	"vk-intern/internal/models"
 	"vk-intern/internal/services"
 )
 
+const (
+	defaultKeysLimit = 100
+	maxKeysLimit     = 1000
+)
+
 func (s *Server) newRouter() *http.ServeMux {
 	router := http.NewServeMux()
 
+	router.HandleFunc("GET /.well-known/jwks.json", handleFunc(s.jwks))
+	router.Handle("GET /metrics", metrics.Handler())
+	router.HandleFunc("GET /healthz", handleFunc(s.healthz))
+	router.HandleFunc("GET /readyz", handleFunc(s.readyz))
+
 	router.HandleFunc("POST /api/login", handleFunc(s.login))
-	router.HandleFunc("POST /api/write", handleFunc(s.withAuth(s.write)))
-	router.HandleFunc("POST /api/read", handleFunc(s.withAuth(s.read)))
+	router.HandleFunc("POST /api/refresh", handleFunc(s.refresh))
+	router.HandleFunc("POST /api/logout", handleFunc(s.withAuth(s.logout)))
+	router.HandleFunc("POST /api/write", handleFunc(s.withRole(models.RoleWriter, s.write)))
+	router.HandleFunc("POST /api/read", handleFunc(s.withRole(models.RoleReader, s.read)))
+	router.HandleFunc("POST /api/incr", handleFunc(s.withRole(models.RoleWriter, s.incr)))
+	router.HandleFunc("POST /api/delete", handleFunc(s.withRole(models.RoleWriter, s.delete)))
+	router.HandleFunc("GET /api/keys", handleFunc(s.withRole(models.RoleReader, s.keys)))
+	router.HandleFunc("GET /api/keys/{key}", handleFunc(s.withRole(models.RoleReader, s.getKey)))
+	router.HandleFunc("PUT /api/keys/{key}", handleFunc(s.withRole(models.RoleWriter, s.putKey)))
+	router.HandleFunc("DELETE /api/keys/{key}", handleFunc(s.withRole(models.RoleWriter, s.deleteKey)))
+	router.HandleFunc("PATCH /api/keys/{key}", handleFunc(s.withRole(models.RoleWriter, s.patchKey)))
+	router.HandleFunc("GET /api/watch", handleFunc(s.withRole(models.RoleReader, s.watch)))
+
+	router.HandleFunc("POST /api/users", handleFunc(s.withRole(models.RoleAdmin, s.createUser)))
+	router.HandleFunc("GET /api/users", handleFunc(s.withRole(models.RoleAdmin, s.listUsers)))
+	router.HandleFunc("PUT /api/users/{username}", handleFunc(s.withRole(models.RoleAdmin, s.updateUser)))
+	router.HandleFunc("DELETE /api/users/{username}", handleFunc(s.withRole(models.RoleAdmin, s.deleteUser)))
+
+	router.HandleFunc("POST /api/apikeys", handleFunc(s.withAuth(s.createAPIKey)))
+	router.HandleFunc("GET /api/apikeys", handleFunc(s.withAuth(s.listAPIKeys)))
+	router.HandleFunc("DELETE /api/apikeys/{id}", handleFunc(s.withAuth(s.deleteAPIKey)))
+
+	router.HandleFunc("GET /api/acl", handleFunc(s.withRole(models.RoleAdmin, s.listGrants)))
+	router.HandleFunc("PUT /api/acl", handleFunc(s.withRole(models.RoleAdmin, s.putGrant)))
+	router.HandleFunc("DELETE /api/acl", handleFunc(s.withRole(models.RoleAdmin, s.deleteGrant)))
 
 	return router
 }
 
+// jwks отдает открытые ключи для проверки токенов другими сервисами
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	return writeJSON(w, http.StatusOK, s.jwtKeys.JWKS())
+}
+
 func (s *Server) login(w http.ResponseWriter, r *http.Request) error {
 	const op = "server.login"
 	log := s.log.With(slog.String("op", op))
@@ -29,7 +72,7 @@ func (s *Server) login(w http.ResponseWriter, r *http.Request) error {
 	if err := json.NewDecoder(r.Body).Decode(loginReq); err != nil {
 		log.Error("Не удалось преобразовать запроса в объект",
 			slog.String("error", err.Error()))
-		return writeErr(r, http.StatusBadRequest, ErrNoLogPass)
+		return decodeErr(r, err, ErrNoLogPass)
 	}
 	defer r.Body.Close()
 
@@ -38,19 +81,99 @@ func (s *Server) login(w http.ResponseWriter, r *http.Request) error {
 		return writeErr(r, http.StatusBadRequest, ErrNoLogPass)
 	}
 
-	token, err := s.auth.Login(r.Context(), s.cfg.Secret,
-		loginReq.Username, loginReq.Password, s.cfg.Server.Token,
+	token, refreshToken, err := s.auth.Login(r.Context(), s.jwtKeys,
+		loginReq.Username, loginReq.Password, s.clientIP(r),
+		s.cfg.Server.Token, s.cfg.Server.Refresh,
 	)
 	if err != nil {
 		log.Error("Ошибка авторизации пользователя",
 			slog.String("error", err.Error()))
-		return writeErr(r, http.StatusUnauthorized, ErrInvalidCred)
+
+		var lockedErr *services.LockedError
+		if errors.As(err, &lockedErr) {
+			metrics.LoginAttempts.WithLabelValues(metrics.LoginLocked).Inc()
+			retryAfter := (lockedErr.RetryAfter + time.Second - 1) / time.Second
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter)))
+			return writeErr(r, http.StatusTooManyRequests, services.ErrLoginLocked)
+		}
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			metrics.LoginAttempts.WithLabelValues(metrics.LoginFailure).Inc()
+			return writeErr(r, http.StatusUnauthorized, services.ErrInvalidCredentials)
+		}
+		return writeErr(r, http.StatusInternalServerError, services.ErrInternal)
 	}
+	metrics.LoginAttempts.WithLabelValues(metrics.LoginSuccess).Inc()
 
-	loginResp := &models.LoginResponse{Token: token}
+	loginResp := &models.LoginResponse{Token: token, RefreshToken: refreshToken}
 	return writeJSON(w, http.StatusOK, loginResp)
 }
 
+func (s *Server) refresh(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.refresh"
+	log := s.log.With(slog.String("op", op))
+
+	refreshReq := &models.RefreshRequest{}
+	log.Info("Преобразование запроса в объект")
+	if err := json.NewDecoder(r.Body).Decode(refreshReq); err != nil {
+		log.Error("Не удалось преобразовать запрос в объект",
+			slog.String("error", err.Error()))
+		return decodeErr(r, err, ErrBadReq)
+	}
+	defer r.Body.Close()
+
+	if refreshReq.RefreshToken == "" {
+		log.Error("Нет токена обновления")
+		return writeErr(r, http.StatusBadRequest, ErrBadReq)
+	}
+
+	token, err := s.auth.Refresh(r.Context(), s.jwtKeys,
+		refreshReq.RefreshToken, s.cfg.Server.Token,
+	)
+	if err != nil {
+		log.Error("Не удалось обновить токен",
+			slog.String("error", err.Error()))
+		return writeErr(r, http.StatusUnauthorized, ErrUnauth)
+	}
+
+	refreshResp := &models.LoginResponse{Token: token}
+	return writeJSON(w, http.StatusOK, refreshResp)
+}
+
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.logout"
+	log := s.log.With(slog.String("op", op))
+
+	// Тело необязательно, без него отзывается только токен доступа
+	logoutReq := &models.LogoutRequest{}
+	if err := json.NewDecoder(r.Body).Decode(logoutReq); err != nil && !errors.Is(err, io.EOF) {
+		log.Error("Не удалось преобразовать запрос в объект",
+			slog.String("error", err.Error()))
+		return decodeErr(r, err, ErrBadReq)
+	}
+	defer r.Body.Close()
+
+	// При входе по API-ключу токена доступа нет, такие ключи отзываются через api/apikeys
+	claims := claimsFromContext(r.Context())
+	if claims == nil {
+		log.Error("Запрос авторизован без токена доступа")
+		return writeErr(r, http.StatusBadRequest, services.ErrBadToken)
+	}
+
+	if err := s.auth.Logout(r.Context(), s.jwtKeys,
+		claims, logoutReq.RefreshToken,
+	); err != nil {
+		log.Error("Не удалось отозвать токены",
+			slog.String("error", err.Error()))
+		if errors.Is(err, services.ErrInternal) {
+			return writeErr(r, http.StatusInternalServerError, services.ErrInternal)
+		}
+		return writeErr(r, http.StatusBadRequest, services.ErrBadToken)
+	}
+
+	logoutResp := &models.LogoutResponse{Status: "success"}
+	return writeJSON(w, http.StatusOK, logoutResp)
+}
+
 func (s *Server) write(w http.ResponseWriter, r *http.Request) error {
 	const op = "server.write"
 	log := s.log.With(slog.String("op", op))
@@ -60,7 +183,7 @@ func (s *Server) write(w http.ResponseWriter, r *http.Request) error {
 	if err := json.NewDecoder(r.Body).Decode(writeReq); err != nil {
 		log.Error("Не удалось преобразовать запрос в объект",
 			slog.String("error", err.Error()))
-		return writeErr(r, http.StatusBadRequest, ErrBadReq)
+		return decodeErr(r, err, ErrBadReq)
 	}
 	defer r.Body.Close()
 
@@ -69,9 +192,42 @@ func (s *Server) write(w http.ResponseWriter, r *http.Request) error {
 		return writeErr(r, http.StatusBadRequest, ErrBadReq)
 	}
 
-	if err := s.storage.Write(r.Context(),
-		s.cfg.Server.Timeout, writeReq.Data,
-	); err != nil {
+	if err := s.checkData(r, writeReq.Data); err != nil {
+		log.Error("Запрос превышает ограничения", slog.String("error", err.Error()))
+		return err
+	}
+
+	metrics.BatchKeys.WithLabelValues("write").Observe(float64(len(writeReq.Data)))
+
+	ttl, err := writeTTL(writeReq)
+	if err != nil {
+		log.Error("Некорректное время жизни ключей",
+			slog.String("error", err.Error()))
+		return writeErr(r, http.StatusBadRequest, err)
+	}
+
+	for key := range writeReq.Versions {
+		if _, ok := writeReq.Data[key]; !ok {
+			log.Error("Версия указана для незаписываемого ключа", slog.String("key", key))
+			return writeErr(r, http.StatusBadRequest, ErrBadReq)
+		}
+	}
+
+	if writeReq.Atomic && writeReq.BestEffort {
+		log.Error("Атомарная запись не может быть частичной")
+		return writeErr(r, http.StatusBadRequest, ErrBadReq)
+	}
+
+	// Условная запись выполняется в одной транзакции, чтобы при конфликте
+	// не остались записанными ключи, о версиях которых клиент не узнает
+	if writeReq.Atomic || (len(writeReq.Versions) != 0 && !writeReq.BestEffort) {
+		return s.writeAtomic(w, r, writeReq, ttl)
+	}
+
+	versions, failed, denied, err := s.storage.Write(r.Context(),
+		s.cfg.Server.Timeout, writeReq.Data, ttl, writeReq.Versions,
+	)
+	if err != nil {
 		if errors.Is(err, services.ErrInternal) {
 			return writeErr(r, http.StatusBadRequest, err)
 		}
@@ -81,10 +237,175 @@ func (s *Server) write(w http.ResponseWriter, r *http.Request) error {
 		return writeErr(r, http.StatusInternalServerError, err)
 	}
 
-	writeResp := &models.WriteResponse{Status: "success"}
+	if writeReq.BestEffort {
+		return writeResults(w, versions, failed, denied)
+	}
+
+	if len(failed) != 0 {
+		log.Error("Часть данных не записана", slog.Int("failed", len(failed)))
+		for _, err := range failed {
+			if !errors.Is(err, services.ErrConflict) {
+				return writeErr(r, http.StatusInternalServerError, services.ErrInternal)
+			}
+		}
+		return writeErr(r, http.StatusConflict, services.ErrConflict)
+	}
+
+	writeResp := &models.WriteResponse{
+		Status:   models.WriteStatusSuccess,
+		Versions: versions,
+		Denied:   denied,
+	}
+	return writeJSON(w, http.StatusCreated, writeResp)
+}
+
+// writeResults отдает результат записи каждого ключа. Если хотя бы один ключ
+// не записан, ответ 207 Multi-Status, иначе 201.
+func writeResults(w http.ResponseWriter,
+	versions models.Versions, failed map[string]error, denied []string,
+) error {
+	results := make(map[string]*models.KeyStatus, len(versions)+len(failed)+len(denied))
+	for key, version := range versions {
+		results[key] = &models.KeyStatus{Status: models.KeyStatusOK, Version: version}
+	}
+
+	for key, err := range failed {
+		code := http.StatusInternalServerError
+		if errors.Is(err, services.ErrConflict) {
+			code = http.StatusConflict
+		}
+		results[key] = &models.KeyStatus{Status: models.KeyStatusError, Code: code, Error: err.Error()}
+	}
+
+	for _, key := range denied {
+		results[key] = &models.KeyStatus{
+			Status: models.KeyStatusError,
+			Code:   http.StatusForbidden,
+			Error:  services.ErrAccessDenied.Error(),
+		}
+	}
+
+	status, writeStatus := http.StatusCreated, models.WriteStatusSuccess
+	if len(failed) != 0 || len(denied) != 0 {
+		status, writeStatus = http.StatusMultiStatus, models.WriteStatusPartial
+	}
+
+	writeResp := &models.WriteResponse{
+		Status:   writeStatus,
+		Versions: versions,
+		Denied:   denied,
+		Results:  results,
+	}
+	return writeJSON(w, status, writeResp)
+}
+
+// writeTTL собирает время жизни ключей из запроса.
+// TTL отдельного ключа имеет приоритет над TTL всего запроса.
+func writeTTL(writeReq *models.WriteRequest) (models.TTL, error) {
+	if writeReq.TTL < 0 {
+		return nil, ErrBadTTL
+	}
+
+	ttl := make(models.TTL)
+	for key, sec := range writeReq.KeyTTL {
+		if _, ok := writeReq.Data[key]; !ok || sec < 0 {
+			return nil, ErrBadTTL
+		}
+	}
+
+	for key := range writeReq.Data {
+		sec, ok := writeReq.KeyTTL[key]
+		if !ok {
+			sec = writeReq.TTL
+		}
+
+		if sec > 0 {
+			ttl[key] = time.Duration(sec) * time.Second
+		}
+	}
+
+	return ttl, nil
+}
+
+func (s *Server) writeAtomic(w http.ResponseWriter, r *http.Request,
+	writeReq *models.WriteRequest, ttl models.TTL,
+) error {
+	const op = "server.writeAtomic"
+	log := s.log.With(slog.String("op", op))
+
+	versions, denied, err := s.storage.WriteAtomic(r.Context(),
+		s.cfg.Server.Timeout, writeReq.Data, ttl, writeReq.Versions,
+	)
+	if err != nil {
+		log.Error("Транзакция не выполнена",
+			slog.String("error", err.Error()))
+
+		if errors.Is(err, services.ErrRolledBack) {
+			status, respErr := http.StatusInternalServerError, services.ErrRolledBack
+			if errors.Is(err, services.ErrConflict) {
+				status, respErr = http.StatusConflict, services.ErrConflict
+			}
+			if errors.Is(err, services.ErrAccessDenied) {
+				status, respErr = http.StatusForbidden, services.ErrAccessDenied
+			}
+
+			writeResp := &models.WriteResponse{
+				Status: models.WriteStatusRolledBack,
+				Denied: denied,
+				Error:  respErr.Error(),
+			}
+			return writeJSON(w, status, writeResp)
+		}
+
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	writeResp := &models.WriteResponse{
+		Status:   models.WriteStatusCommitted,
+		Versions: versions,
+	}
 	return writeJSON(w, http.StatusCreated, writeResp)
 }
 
+func (s *Server) incr(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.incr"
+	log := s.log.With(slog.String("op", op))
+
+	incrReq := &models.IncrRequest{}
+	log.Info("Преобразование запроса в объект")
+	if err := json.NewDecoder(r.Body).Decode(incrReq); err != nil {
+		log.Error("Не удалось преобразовать запрос в объект",
+			slog.String("error", err.Error()))
+		return decodeErr(r, err, ErrBadReq)
+	}
+	defer r.Body.Close()
+
+	if len(incrReq.Deltas) == 0 {
+		log.Error("Нет ключей для изменения")
+		return writeErr(r, http.StatusBadRequest, ErrBadReq)
+	}
+
+	if err := s.checkKeys(r, mapKeys(incrReq.Deltas)); err != nil {
+		log.Error("Запрос превышает ограничения", slog.String("error", err.Error()))
+		return err
+	}
+
+	metrics.BatchKeys.WithLabelValues("incr").Observe(float64(len(incrReq.Deltas)))
+
+	values, versions, denied, err := s.storage.Incr(r.Context(), s.cfg.Server.Timeout, incrReq.Deltas)
+	if err != nil {
+		log.Error("Не удалось увеличить значения",
+			slog.String("error", err.Error()))
+		if errors.Is(err, services.ErrNotNumeric) {
+			return writeErr(r, http.StatusConflict, services.ErrNotNumeric)
+		}
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	incrResp := &models.IncrResponse{Values: values, Versions: versions, Denied: denied}
+	return writeJSON(w, http.StatusOK, incrResp)
+}
+
 func (s *Server) read(w http.ResponseWriter, r *http.Request) error {
 	const op = "server.read"
 	log := s.log.With(slog.String("op", op))
@@ -94,7 +415,7 @@ func (s *Server) read(w http.ResponseWriter, r *http.Request) error {
 	if err := json.NewDecoder(r.Body).Decode(readReq); err != nil {
 		log.Error("Не удалось преобразовать запрос в объект",
 			slog.String("error", err.Error()))
-		return writeErr(r, http.StatusBadRequest, ErrBadReq)
+		return decodeErr(r, err, ErrBadReq)
 	}
 	defer r.Body.Close()
 
@@ -103,7 +424,14 @@ func (s *Server) read(w http.ResponseWriter, r *http.Request) error {
 		return writeErr(r, http.StatusBadRequest, ErrBadReq)
 	}
 
-	data, err := s.storage.Read(r.Context(), s.cfg.Server.Timeout, readReq.Keys)
+	if err := s.checkKeys(r, readReq.Keys); err != nil {
+		log.Error("Запрос превышает ограничения", slog.String("error", err.Error()))
+		return err
+	}
+
+	metrics.BatchKeys.WithLabelValues("read").Observe(float64(len(readReq.Keys)))
+
+	data, versions, missing, denied, err := s.storage.Read(r.Context(), s.cfg.Server.Timeout, readReq.Keys)
 	if err != nil {
 		if errors.Is(err, services.ErrInternal) {
 			return writeErr(r, http.StatusBadRequest, err)
@@ -114,6 +442,111 @@ func (s *Server) read(w http.ResponseWriter, r *http.Request) error {
 		return writeErr(r, http.StatusInternalServerError, err)
 	}
 
-	readResp := &models.ReadResponse{Data: data}
+	if readReq.Strict && len(missing) != 0 {
+		log.Error("Часть ключей не найдена", slog.Any("missing", missing))
+		readResp := &models.ReadResponse{Missing: missing, Denied: denied, Error: ErrKeysMissing.Error()}
+		return writeJSON(w, http.StatusNotFound, readResp)
+	}
+
+	readResp := &models.ReadResponse{Data: data, Versions: versions, Missing: missing, Denied: denied}
 	return writeJSON(w, http.StatusOK, readResp)
 }
+
+func (s *Server) keys(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.keys"
+	log := s.log.With(slog.String("op", op))
+
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	after := query.Get("after")
+	values := query.Get("values") == "true"
+
+	limit := defaultKeysLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxKeysLimit {
+			log.Error("Некорректный лимит", slog.String("limit", l))
+			return writeErr(r, http.StatusBadRequest, ErrBadLimit)
+		}
+		limit = n
+	}
+
+	if err := s.checkKey(r, prefix); err != nil {
+		log.Error("Запрос превышает ограничения", slog.String("error", err.Error()))
+		return err
+	}
+	if err := s.checkKey(r, after); err != nil {
+		log.Error("Запрос превышает ограничения", slog.String("error", err.Error()))
+		return err
+	}
+
+	pairs, next, err := s.storage.Scan(r.Context(), s.cfg.Server.Timeout, prefix, after, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrInternal) {
+			return writeErr(r, http.StatusBadRequest, err)
+		}
+
+		log.Error("Не удалось получить ключи",
+			slog.String("error", err.Error()))
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	keysResp := &models.KeysResponse{
+		Keys: make([]string, 0, len(pairs)),
+		Next: next,
+	}
+	if values {
+		keysResp.Data = make(models.Data, len(pairs))
+		keysResp.Versions = make(models.Versions, len(pairs))
+	}
+
+	for _, pair := range pairs {
+		keysResp.Keys = append(keysResp.Keys, pair.Key)
+		if values {
+			keysResp.Data[pair.Key] = pair.Value
+			keysResp.Versions[pair.Key] = pair.Version
+		}
+	}
+
+	return writeJSON(w, http.StatusOK, keysResp)
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.delete"
+	log := s.log.With(slog.String("op", op))
+
+	deleteReq := &models.DeleteRequest{}
+	log.Info("Преобразование запроса в объект")
+	if err := json.NewDecoder(r.Body).Decode(deleteReq); err != nil {
+		log.Error("Не удалось преобразовать запрос в объект",
+			slog.String("error", err.Error()))
+		return decodeErr(r, err, ErrBadReq)
+	}
+	defer r.Body.Close()
+
+	if len(deleteReq.Keys) == 0 {
+		log.Error("Нет ключей для удаления")
+		return writeErr(r, http.StatusBadRequest, ErrBadReq)
+	}
+
+	if err := s.checkKeys(r, deleteReq.Keys); err != nil {
+		log.Error("Запрос превышает ограничения", slog.String("error", err.Error()))
+		return err
+	}
+
+	metrics.BatchKeys.WithLabelValues("delete").Observe(float64(len(deleteReq.Keys)))
+
+	deleted, denied, err := s.storage.Delete(r.Context(), s.cfg.Server.Timeout, deleteReq.Keys)
+	if err != nil {
+		if errors.Is(err, services.ErrInternal) {
+			return writeErr(r, http.StatusBadRequest, err)
+		}
+
+		log.Error("Не удалось удалить данные",
+			slog.String("error", err.Error()))
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	deleteResp := &models.DeleteResponse{Deleted: deleted, Denied: denied}
+	return writeJSON(w, http.StatusOK, deleteResp)
+}
@@ -0,0 +1,447 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"vk-intern/internal/config"
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
+)
+
+func TestDelete(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+
+	resp, body := ts.admin(t, http.MethodPost, "/api/write", models.WriteRequest{
+		Data: models.Data{"a": 1, "b": 2},
+	}, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	resp, body = ts.admin(t, http.MethodPost, "/api/delete", models.DeleteRequest{
+		Keys: []string{"a", "none"},
+	}, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	deleteResp := &models.DeleteResponse{}
+	decode(t, body, deleteResp)
+	if !slices.Equal(deleteResp.Deleted, []string{"a"}) {
+		t.Errorf("удалены %v, want [a]", deleteResp.Deleted)
+	}
+
+	resp, body = ts.admin(t, http.MethodPost, "/api/read", models.ReadRequest{Keys: []string{"a", "b"}}, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	readResp := &models.ReadResponse{}
+	decode(t, body, readResp)
+	if _, ok := readResp.Data["a"]; ok || readResp.Data["b"] != 2.0 {
+		t.Errorf("после удаления %s, want только b", body)
+	}
+}
+
+func TestWriteTTL(t *testing.T) {
+	data := models.Data{"a": 1, "b": 2, "c": 3}
+
+	tests := []struct {
+		name    string
+		req     *models.WriteRequest
+		want    models.TTL
+		wantErr bool
+	}{
+		{
+			name: "без времени жизни",
+			req:  &models.WriteRequest{Data: data},
+			want: models.TTL{},
+		},
+		{
+			name: "общее время жизни",
+			req:  &models.WriteRequest{Data: data, TTL: 60},
+			want: models.TTL{"a": time.Minute, "b": time.Minute, "c": time.Minute},
+		},
+		{
+			name: "время жизни ключа важнее общего",
+			req:  &models.WriteRequest{Data: data, TTL: 60, KeyTTL: map[string]int64{"b": 5}},
+			want: models.TTL{"a": time.Minute, "b": 5 * time.Second, "c": time.Minute},
+		},
+		{
+			name: "ключ с 0 бессрочный при общем времени жизни",
+			req:  &models.WriteRequest{Data: data, TTL: 60, KeyTTL: map[string]int64{"c": 0}},
+			want: models.TTL{"a": time.Minute, "b": time.Minute},
+		},
+		{
+			name: "только время жизни ключа",
+			req:  &models.WriteRequest{Data: data, KeyTTL: map[string]int64{"a": 10}},
+			want: models.TTL{"a": 10 * time.Second},
+		},
+		{
+			name:    "отрицательное общее время жизни",
+			req:     &models.WriteRequest{Data: data, TTL: -1},
+			wantErr: true,
+		},
+		{
+			name:    "отрицательное время жизни ключа",
+			req:     &models.WriteRequest{Data: data, KeyTTL: map[string]int64{"a": -1}},
+			wantErr: true,
+		},
+		{
+			name:    "время жизни незаписываемого ключа",
+			req:     &models.WriteRequest{Data: data, KeyTTL: map[string]int64{"x": 10}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := writeTTL(tt.req)
+		if tt.wantErr {
+			if !errors.Is(err, ErrBadTTL) {
+				t.Errorf("%s: ошибка %v, want %v", tt.name, err, ErrBadTTL)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: неожиданная ошибка %v", tt.name, err)
+			continue
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConditionalWrite(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+
+	resp, body := ts.admin(t, http.MethodPost, "/api/write", models.WriteRequest{Data: models.Data{"a": 1}}, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+	writeResp := &models.WriteResponse{}
+	decode(t, body, writeResp)
+	version := writeResp.Versions["a"]
+
+	// Ключ удален и создан заново, прежняя версия больше не подходит
+	resp, body = ts.admin(t, http.MethodDelete, "/api/keys/a", nil, nil)
+	wantStatus(t, resp, body, http.StatusNoContent)
+	resp, body = ts.admin(t, http.MethodPost, "/api/write", models.WriteRequest{Data: models.Data{"a": 2}}, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	// При конфликте условная запись не записывает ни один ключ
+	resp, body = ts.admin(t, http.MethodPost, "/api/write", models.WriteRequest{
+		Data:     models.Data{"a": 3, "b": 1},
+		Versions: models.Versions{"a": version},
+	}, nil)
+	wantStatus(t, resp, body, http.StatusConflict)
+
+	resp, body = ts.admin(t, http.MethodPost, "/api/read", models.ReadRequest{Keys: []string{"a", "b"}}, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	readResp := &models.ReadResponse{}
+	decode(t, body, readResp)
+	if readResp.Data["a"] != 2.0 || !slices.Equal(readResp.Missing, []string{"b"}) {
+		t.Errorf("после конфликта %s, want a=2 без b", body)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+
+	resp, body := ts.admin(t, http.MethodPost, "/api/write", models.WriteRequest{
+		Data: models.Data{"p:a": 1, "p:b": 2, "q:a": 3},
+	}, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	resp, body = ts.admin(t, http.MethodGet, "/api/keys?prefix=p:&limit=1&values=true", nil, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	keysResp := &models.KeysResponse{}
+	decode(t, body, keysResp)
+	if !slices.Equal(keysResp.Keys, []string{"p:a"}) || keysResp.Next != "p:a" || keysResp.Data["p:a"] != 1.0 {
+		t.Fatalf("первая страница %s", body)
+	}
+
+	resp, body = ts.admin(t, http.MethodGet, "/api/keys?prefix=p:&limit=1&after="+keysResp.Next, nil, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	keysResp = &models.KeysResponse{}
+	decode(t, body, keysResp)
+	if !slices.Equal(keysResp.Keys, []string{"p:b"}) || keysResp.Next != "" || keysResp.Data != nil {
+		t.Fatalf("вторая страница %s", body)
+	}
+
+	resp, body = ts.admin(t, http.MethodGet, "/api/keys?limit=0", nil, nil)
+	wantStatus(t, resp, body, http.StatusBadRequest)
+}
+
+func TestRefreshLogout(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+
+	resp, body := ts.do(t, "", http.MethodPost, "/api/login",
+		models.LoginRequest{Username: "admin", Password: "presale"}, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	loginResp := &models.LoginResponse{}
+	decode(t, body, loginResp)
+
+	// Токен доступа нельзя использовать как токен обновления
+	resp, body = ts.do(t, "", http.MethodPost, "/api/refresh",
+		models.RefreshRequest{RefreshToken: loginResp.Token}, nil)
+	wantStatus(t, resp, body, http.StatusUnauthorized)
+
+	resp, body = ts.do(t, "", http.MethodPost, "/api/refresh",
+		models.RefreshRequest{RefreshToken: loginResp.RefreshToken}, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	refreshResp := &models.LoginResponse{}
+	decode(t, body, refreshResp)
+	token := refreshResp.Token
+
+	resp, body = ts.do(t, token, http.MethodGet, "/api/keys", nil, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+
+	resp, body = ts.do(t, token, http.MethodPost, "/api/logout",
+		models.LogoutRequest{RefreshToken: loginResp.RefreshToken}, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+
+	// Отозванные токены больше не принимаются, остальные токены действуют
+	resp, body = ts.do(t, token, http.MethodGet, "/api/keys", nil, nil)
+	wantStatus(t, resp, body, http.StatusUnauthorized)
+
+	resp, body = ts.do(t, "", http.MethodPost, "/api/refresh",
+		models.RefreshRequest{RefreshToken: loginResp.RefreshToken}, nil)
+	wantStatus(t, resp, body, http.StatusUnauthorized)
+
+	resp, body = ts.do(t, loginResp.Token, http.MethodGet, "/api/keys", nil, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+}
+
+func TestLoginLockout(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+
+	resp, wrongBody := ts.do(t, "", http.MethodPost, "/api/login",
+		models.LoginRequest{Username: "admin", Password: "wrong"}, nil)
+	wantStatus(t, resp, wrongBody, http.StatusUnauthorized)
+
+	// После неудачи вход заблокирован на base-delay даже с правильным паролем
+	resp, body := ts.do(t, "", http.MethodPost, "/api/login",
+		models.LoginRequest{Username: "admin", Password: "presale"}, nil)
+	wantStatus(t, resp, body, http.StatusTooManyRequests)
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("ответ 429 без Retry-After")
+	}
+
+	// Неизвестный пользователь получает тот же ответ, что и неверный пароль.
+	// Адрес клиента после неудачи тоже заблокирован, поэтому нужен новый сервер.
+	ts = newTestServer(t, config.LimitsConfig{})
+	resp, body = ts.do(t, "", http.MethodPost, "/api/login",
+		models.LoginRequest{Username: "nobody", Password: "wrong"}, nil)
+	wantStatus(t, resp, body, http.StatusUnauthorized)
+	if string(body) != string(wrongBody) {
+		t.Errorf("ответ для неизвестного пользователя %s, want %s", body, wrongBody)
+	}
+}
+
+func TestIncr(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+
+	resp, body := ts.admin(t, http.MethodPost, "/api/write", models.WriteRequest{
+		Data: models.Data{"n": 1, "s": "text"},
+	}, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	// Отсутствующий ключ создается со значением приращения
+	resp, body = ts.admin(t, http.MethodPost, "/api/incr", models.IncrRequest{
+		Deltas: map[string]float64{"n": 2, "new": -1.5},
+	}, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	incrResp := &models.IncrResponse{}
+	decode(t, body, incrResp)
+	if incrResp.Values["n"] != 3 || incrResp.Values["new"] != -1.5 {
+		t.Errorf("значения после incr %v, want n=3 и new=-1.5", incrResp.Values)
+	}
+
+	// Если одно из значений не число, не меняется ни один ключ
+	resp, body = ts.admin(t, http.MethodPost, "/api/incr", models.IncrRequest{
+		Deltas: map[string]float64{"n": 1, "s": 1},
+	}, nil)
+	wantStatus(t, resp, body, http.StatusConflict)
+
+	resp, body = ts.admin(t, http.MethodPost, "/api/read", models.ReadRequest{Keys: []string{"n", "s"}}, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	readResp := &models.ReadResponse{}
+	decode(t, body, readResp)
+	if readResp.Data["n"] != 3.0 || readResp.Data["s"] != "text" {
+		t.Errorf("после ошибки incr %s, want n=3 и s=text", body)
+	}
+}
+
+func TestIncrConcurrent(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+
+	const workers, increments = 10, 20
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range increments {
+				resp, body := ts.admin(t, http.MethodPost, "/api/incr", models.IncrRequest{
+					Deltas: map[string]float64{"counter": 1},
+				}, nil)
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("incr: код %d: %s", resp.StatusCode, body)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	resp, body := ts.admin(t, http.MethodPost, "/api/read", models.ReadRequest{Keys: []string{"counter"}}, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	readResp := &models.ReadResponse{}
+	decode(t, body, readResp)
+	if want := float64(workers * increments); readResp.Data["counter"] != want {
+		t.Errorf("счетчик %v, want %v", readResp.Data["counter"], want)
+	}
+}
+
+func TestReadMissing(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+
+	resp, body := ts.admin(t, http.MethodPost, "/api/write", models.WriteRequest{
+		Data: models.Data{"a": 1, "n": nil},
+	}, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	resp, body = ts.admin(t, http.MethodPost, "/api/read", models.ReadRequest{Keys: []string{"a", "n", "x", "y"}}, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	readResp := &models.ReadResponse{}
+	decode(t, body, readResp)
+	if _, ok := readResp.Data["n"]; !ok {
+		t.Error("ключ со значением null не вернулся в data")
+	}
+	if want := []string{"x", "y"}; !slices.Equal(readResp.Missing, want) {
+		t.Errorf("missing %v, want %v", readResp.Missing, want)
+	}
+
+	resp, body = ts.admin(t, http.MethodPost, "/api/read", models.ReadRequest{Keys: []string{"a", "x"}, Strict: true}, nil)
+	wantStatus(t, resp, body, http.StatusNotFound)
+	decode(t, body, readResp)
+	if want := []string{"x"}; !slices.Equal(readResp.Missing, want) {
+		t.Errorf("missing в режиме strict %v, want %v", readResp.Missing, want)
+	}
+}
+
+func TestWriteBestEffort(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+
+	resp, body := ts.admin(t, http.MethodPost, "/api/write", models.WriteRequest{Data: models.Data{"a": 1}}, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+	writeResp := &models.WriteResponse{}
+	decode(t, body, writeResp)
+	version := writeResp.Versions["a"]
+
+	resp, body = ts.admin(t, http.MethodPost, "/api/write", models.WriteRequest{Data: models.Data{"a": 2}}, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	// С best_effort записываются ключи без конфликта
+	resp, body = ts.admin(t, http.MethodPost, "/api/write", models.WriteRequest{
+		Data:       models.Data{"a": 3, "b": 1},
+		Versions:   models.Versions{"a": version},
+		BestEffort: true,
+	}, nil)
+	wantStatus(t, resp, body, http.StatusMultiStatus)
+	writeResp = &models.WriteResponse{}
+	decode(t, body, writeResp)
+	if writeResp.Results["a"].Code != http.StatusConflict || writeResp.Results["b"].Status != models.KeyStatusOK {
+		t.Errorf("результаты best_effort %s", body)
+	}
+
+	resp, body = ts.admin(t, http.MethodPost, "/api/read", models.ReadRequest{Keys: []string{"a", "b"}}, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	readResp := &models.ReadResponse{}
+	decode(t, body, readResp)
+	if readResp.Data["a"] != 2.0 || readResp.Data["b"] != 1.0 {
+		t.Errorf("после best_effort %s, want a=2 и b=1", body)
+	}
+}
+
+func TestWriteResults(t *testing.T) {
+	tests := []struct {
+		name       string
+		versions   models.Versions
+		failed     map[string]error
+		denied     []string
+		wantStatus int
+		wantWrite  string
+		wantCodes  map[string]int
+	}{
+		{
+			name:       "все ключи записаны",
+			versions:   models.Versions{"a": 1, "b": 2},
+			wantStatus: http.StatusCreated,
+			wantWrite:  models.WriteStatusSuccess,
+			wantCodes:  map[string]int{"a": 0, "b": 0},
+		},
+		{
+			name:       "конфликт версии",
+			versions:   models.Versions{"a": 1},
+			failed:     map[string]error{"b": fmt.Errorf("op: %w", services.ErrConflict)},
+			wantStatus: http.StatusMultiStatus,
+			wantWrite:  models.WriteStatusPartial,
+			wantCodes:  map[string]int{"a": 0, "b": http.StatusConflict},
+		},
+		{
+			name:       "ошибка БД",
+			failed:     map[string]error{"a": services.ErrInternal},
+			wantStatus: http.StatusMultiStatus,
+			wantWrite:  models.WriteStatusPartial,
+			wantCodes:  map[string]int{"a": http.StatusInternalServerError},
+		},
+		{
+			name:       "нет доступа",
+			versions:   models.Versions{"a": 1},
+			denied:     []string{"b"},
+			wantStatus: http.StatusMultiStatus,
+			wantWrite:  models.WriteStatusPartial,
+			wantCodes:  map[string]int{"a": 0, "b": http.StatusForbidden},
+		},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		if err := writeResults(rec, tt.versions, tt.failed, tt.denied); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: код %d, want %d", tt.name, rec.Code, tt.wantStatus)
+		}
+
+		resp := &models.WriteResponse{}
+		if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if resp.Status != tt.wantWrite {
+			t.Errorf("%s: статус %q, want %q", tt.name, resp.Status, tt.wantWrite)
+		}
+		if len(resp.Results) != len(tt.wantCodes) {
+			t.Errorf("%s: результатов %d, want %d", tt.name, len(resp.Results), len(tt.wantCodes))
+		}
+
+		for key, code := range tt.wantCodes {
+			res, ok := resp.Results[key]
+			if !ok {
+				t.Errorf("%s: нет результата ключа %q", tt.name, key)
+				continue
+			}
+			if code == 0 {
+				if res.Status != models.KeyStatusOK || res.Version != tt.versions[key] {
+					t.Errorf("%s: ключ %q: %+v, want ok с версией %d", tt.name, key, res, tt.versions[key])
+				}
+				continue
+			}
+			if res.Status != models.KeyStatusError || res.Code != code {
+				t.Errorf("%s: ключ %q: %+v, want error с кодом %d", tt.name, key, res, code)
+			}
+		}
+	}
+}
@@ -6,47 +6,112 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"vk-intern/internal/config"
+	"vk-intern/internal/jwt"
 	"vk-intern/internal/models"
+	"vk-intern/internal/services"
 )
 
 var (
-	ErrNoLogPass   = errors.New("Поля логина или пароля не должны быть пустые")
-	ErrBadReq      = errors.New("Некорректные данные запроса")
-	ErrUnauth      = errors.New("Пользователь не авторизован")
-	ErrInvalidCred = errors.New("Неправильный логин или пароль")
+	ErrNoLogPass    = errors.New("Поля логина или пароля не должны быть пустые")
+	ErrBadReq       = errors.New("Некорректные данные запроса")
+	ErrUnauth       = errors.New("Пользователь не авторизован")
+	ErrForbidden    = errors.New("Недостаточно прав")
+	ErrBadLimit     = errors.New("Лимит должен быть целым числом от 1 до 1000")
+	ErrBadTTL       = errors.New("Время жизни должно быть неотрицательным и относиться к записываемым ключам")
+	ErrKeysMissing  = errors.New("Часть ключей не найдена")
+	ErrBodyTooLarge = errors.New("Тело запроса превышает допустимый размер")
+	ErrTooManyKeys  = errors.New("Слишком много ключей в одном запросе")
+	ErrKeyTooLong   = errors.New("Ключ превышает допустимую длину")
+	ErrPrecondition = errors.New("Значение ключа не соответствует заголовку If-Match или If-None-Match")
+	ErrWatchLost    = errors.New("Часть изменений не передана, перечитайте ключи и подпишитесь заново")
+	ErrPatchType    = errors.New("Тип патча должен быть application/merge-patch+json или application/json-patch+json")
 )
 
 type Auth interface {
-	Login(ctx context.Context, secret, username, password string, duration time.Duration) (string, error)
-	FindUser(ctx context.Context, username string) error
+	Login(ctx context.Context, keys *jwt.Keys, username, password, ip string,
+		duration, refreshDuration time.Duration) (string, string, error)
+	Refresh(ctx context.Context, keys *jwt.Keys, refreshToken string, duration time.Duration) (string, error)
+	ParseToken(ctx context.Context, keys *jwt.Keys, token, typ string) (*jwt.Claims, error)
+	Logout(ctx context.Context, keys *jwt.Keys, access *jwt.Claims, refreshToken string) error
+	FindUser(ctx context.Context, username string) ([]string, error)
+
+	CreateUser(ctx context.Context, username, password string, roles []string) error
+	ListUsers(ctx context.Context) ([]*models.User, error)
+	UpdateUser(ctx context.Context, username, password string, roles []string) error
+	DeleteUser(ctx context.Context, username string) error
+
+	ListGrants(ctx context.Context) ([]*models.Grant, error)
+	PutGrant(ctx context.Context, grant *models.Grant) error
+	DeleteGrant(ctx context.Context, subject, prefix string) error
+
+	CreateAPIKey(ctx context.Context, identity *services.Identity,
+		name string, roles []string) (*models.APIKey, string, error)
+	ListAPIKeys(ctx context.Context, username string) ([]*models.APIKey, error)
+	DeleteAPIKey(ctx context.Context, identity *services.Identity, id string) error
+	CheckAPIKey(ctx context.Context, apiKey string) (*services.Identity, error)
 }
 
 type Storage interface {
-	Write(ctx context.Context, timeout time.Duration, data models.Data) error
-	Read(ctx context.Context, timeout time.Duration, keys []string) (models.Data, error)
+	Write(ctx context.Context, timeout time.Duration,
+		data models.Data, ttl models.TTL, expected models.Versions) (models.Versions, map[string]error, []string, error)
+	WriteAtomic(ctx context.Context, timeout time.Duration,
+		data models.Data, ttl models.TTL, expected models.Versions) (models.Versions, []string, error)
+	Read(ctx context.Context, timeout time.Duration,
+		keys []string) (models.Data, models.Versions, []string, []string, error)
+	Get(ctx context.Context, timeout time.Duration, key string) (*models.Pair, error)
+	Patch(ctx context.Context, timeout time.Duration,
+		key, patchType string, patch []byte, expected uint64, maxSize int) (*models.Pair, error)
+	Incr(ctx context.Context, timeout time.Duration,
+		deltas map[string]float64) (map[string]float64, models.Versions, []string, error)
+	Scan(ctx context.Context, timeout time.Duration,
+		prefix, after string, limit int) ([]*models.Pair, string, error)
+	Delete(ctx context.Context, timeout time.Duration, keys []string) ([]string, []string, error)
+	DeleteVersion(ctx context.Context, timeout time.Duration, key string, expected uint64) error
+	Watch(ctx context.Context, keys []string, prefix string) (<-chan *models.Event, error)
+}
+
+// Health проверяет доступность хранилища для /readyz
+type Health interface {
+	Ping(ctx context.Context) error
 }
 
 type Server struct {
-	cfg *config.Config
-	log *slog.Logger
+	cfg     *config.Config
+	log     *slog.Logger
+	jwtKeys *jwt.Keys
 
 	auth    Auth
 	storage Storage
+	health  Health
+
+	// Подсети прокси, которым доверяется X-Forwarded-For
+	trustedProxies []netip.Prefix
+
+	// Сбрасывается перед остановкой, чтобы /readyz вывел сервер из балансировки
+	ready atomic.Bool
+	// Закрывается при остановке сервера, чтобы завершить потоки api/watch
+	shutdown chan struct{}
 }
 
-func New(cfg *config.Config, log *slog.Logger, auth Auth, storage Storage) *Server {
+func New(cfg *config.Config, log *slog.Logger, keys *jwt.Keys, auth Auth, storage Storage, health Health) *Server {
 	return &Server{
-		cfg: cfg,
-		log: log,
+		cfg:     cfg,
+		log:     log,
+		jwtKeys: keys,
 
 		auth:    auth,
 		storage: storage,
+		health:  health,
+
+		shutdown: make(chan struct{}),
 	}
 }
 
@@ -54,20 +119,30 @@ func (s *Server) Run() error {
 	const op = "server.Run"
 	log := s.log.With(slog.String("op", op))
 
+	proxies, err := parseTrustedProxies(s.cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Error("Ошибка в списке доверенных прокси", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.trustedProxies = proxies
+
 	addr := fmt.Sprintf("%s:%d", s.cfg.Server.Host, s.cfg.Server.Port)
 	router := s.newRouter()
 	server := &http.Server{
 		Addr:    addr,
-		Handler: router,
+		Handler: s.withMetrics(router, s.withBodyLimit(router)),
 	}
+	// Shutdown не прерывает активные соединения, поэтому потоки закрываются отдельно
+	server.RegisterOnShutdown(func() { close(s.shutdown) })
 
 	log.Info("Запуск сервера")
 	go func() {
-		if err := server.ListenAndServe(); err != nil {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Error("Произошла ошибка во время работы сервера")
 			panic(err)
 		}
 	}()
+	s.ready.Store(true)
 	log.Info(fmt.Sprintf("Сервер слушает порт %d", s.cfg.Server.Port))
 
 	quit := make(chan os.Signal, 1)
@@ -75,6 +150,13 @@ func (s *Server) Run() error {
 	<-quit
 	log.Info("Завершение работы сервера")
 
+	// Активные запросы дорабатывают, пока балансировщик замечает 503 на /readyz
+	s.ready.Store(false)
+	if delay := s.cfg.Server.ShutdownDelay; delay > 0 {
+		log.Info("Ожидание вывода сервера из балансировки", slog.Duration("delay", delay))
+		time.Sleep(delay)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
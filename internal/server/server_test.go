@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"vk-intern/internal/config"
+	"vk-intern/internal/jwt"
+	"vk-intern/internal/kvstore/memory"
+	"vk-intern/internal/models"
+	"vk-intern/internal/services/auth"
+	"vk-intern/internal/services/storage"
+)
+
+// testServer - весь HTTP-стек поверх хранилища в памяти
+type testServer struct {
+	*httptest.Server
+	server *Server
+	token  string
+}
+
+func newTestServer(t *testing.T, limits config.LimitsConfig) *testServer {
+	t.Helper()
+
+	cfg := &config.Config{
+		Env:    "local",
+		Secret: "test-secret",
+		Server: config.ServerConfig{
+			Token:   time.Hour,
+			Refresh: time.Hour,
+			Timeout: 5 * time.Second,
+			Login: config.LoginConfig{
+				MaxFailures:   5,
+				IPMaxFailures: 20,
+				BaseDelay:     time.Second,
+				MaxDelay:      time.Minute,
+				Lockout:       15 * time.Minute,
+				Window:        15 * time.Minute,
+			},
+			Limits: limits,
+		},
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	kvStore := memory.New(log)
+	t.Cleanup(kvStore.Stop)
+
+	keys, err := jwt.LoadKeys(&cfg.JWT, cfg.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(cfg, log, keys, auth.New(log, kvStore, &cfg.Server.Login), storage.New(log, kvStore), kvStore)
+	s.ready.Store(true)
+
+	router := s.newRouter()
+	ts := &testServer{
+		Server: httptest.NewServer(s.withMetrics(router, s.withBodyLimit(router))),
+		server: s,
+	}
+	t.Cleanup(ts.Close)
+
+	ts.token = ts.login(t, "admin", "presale")
+	return ts
+}
+
+func (ts *testServer) login(t *testing.T, username, password string) string {
+	t.Helper()
+
+	resp, body := ts.do(t, "", http.MethodPost, "/api/login",
+		models.LoginRequest{Username: username, Password: password}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("вход %s: %d %s", username, resp.StatusCode, body)
+	}
+
+	loginResp := &models.LoginResponse{}
+	decode(t, body, loginResp)
+	return loginResp.Token
+}
+
+// do отправляет запрос с токеном token. Тело - строка или объект для JSON.
+func (ts *testServer) do(t *testing.T, token, method, path string,
+	body any, header map[string]string,
+) (*http.Response, []byte) {
+	t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, data
+}
+
+// admin отправляет запрос от имени администратора
+func (ts *testServer) admin(t *testing.T, method, path string, body any, header map[string]string) (*http.Response, []byte) {
+	t.Helper()
+	return ts.do(t, ts.token, method, path, body, header)
+}
+
+func decode(t *testing.T, body []byte, v any) {
+	t.Helper()
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatalf("ответ %s: %v", body, err)
+	}
+}
+
+func wantStatus(t *testing.T, resp *http.Response, body []byte, status int) {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s: код %d, want %d: %s",
+			resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status, body)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+
+	data := models.Data{"a": map[string]any{"x": 1.0}, "b": "s"}
+	resp, body := ts.admin(t, http.MethodPost, "/api/write", models.WriteRequest{Data: data}, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	resp, body = ts.admin(t, http.MethodPost, "/api/read", models.ReadRequest{Keys: []string{"a", "b"}}, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	readResp := &models.ReadResponse{}
+	decode(t, body, readResp)
+	if !equalJSON(readResp.Data, data) {
+		t.Errorf("прочитано %v, want %v", readResp.Data, data)
+	}
+}
+
+func equalJSON(a, b any) bool {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(x, y)
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"vk-intern/internal/kvstore"
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
+)
+
+func (s *Server) createUser(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.createUser"
+	log := s.log.With(slog.String("op", op))
+
+	createReq := &models.CreateUserRequest{}
+	log.Info("Преобразование запроса в объект")
+	if err := json.NewDecoder(r.Body).Decode(createReq); err != nil {
+		log.Error("Не удалось преобразовать запрос в объект",
+			slog.String("error", err.Error()))
+		return decodeErr(r, err, ErrNoLogPass)
+	}
+	defer r.Body.Close()
+
+	if createReq.Username == "" || createReq.Password == "" {
+		log.Error("Нет данных пользователя")
+		return writeErr(r, http.StatusBadRequest, ErrNoLogPass)
+	}
+
+	if err := s.auth.CreateUser(r.Context(),
+		createReq.Username, createReq.Password, createReq.Roles,
+	); err != nil {
+		log.Error("Не удалось создать пользователя",
+			slog.String("error", err.Error()))
+		if errors.Is(err, kvstore.ErrUserExists) {
+			return writeErr(r, http.StatusConflict, kvstore.ErrUserExists)
+		}
+		if errors.Is(err, services.ErrBadRole) {
+			return writeErr(r, http.StatusBadRequest, services.ErrBadRole)
+		}
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	userResp := &models.UserResponse{Username: createReq.Username}
+	return writeJSON(w, http.StatusCreated, userResp)
+}
+
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.listUsers"
+	log := s.log.With(slog.String("op", op))
+
+	users, err := s.auth.ListUsers(r.Context())
+	if err != nil {
+		log.Error("Не удалось получить пользователей",
+			slog.String("error", err.Error()))
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	usersResp := &models.UsersResponse{Users: make([]*models.UserResponse, 0, len(users))}
+	for _, user := range users {
+		usersResp.Users = append(usersResp.Users,
+			&models.UserResponse{Username: user.Username, Roles: user.Roles})
+	}
+	return writeJSON(w, http.StatusOK, usersResp)
+}
+
+func (s *Server) updateUser(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.updateUser"
+	log := s.log.With(slog.String("op", op))
+
+	username := r.PathValue("username")
+
+	updateReq := &models.UpdateUserRequest{}
+	log.Info("Преобразование запроса в объект")
+	if err := json.NewDecoder(r.Body).Decode(updateReq); err != nil {
+		log.Error("Не удалось преобразовать запрос в объект",
+			slog.String("error", err.Error()))
+		return decodeErr(r, err, ErrNoLogPass)
+	}
+	defer r.Body.Close()
+
+	if updateReq.Password == "" && updateReq.Roles == nil {
+		log.Error("Нет данных для обновления")
+		return writeErr(r, http.StatusBadRequest, ErrBadReq)
+	}
+
+	if err := s.auth.UpdateUser(r.Context(),
+		username, updateReq.Password, updateReq.Roles,
+	); err != nil {
+		log.Error("Не удалось обновить пользователя",
+			slog.String("error", err.Error()))
+		if errors.Is(err, kvstore.ErrUserNotFound) {
+			return writeErr(r, http.StatusNotFound, kvstore.ErrUserNotFound)
+		}
+		if errors.Is(err, services.ErrBadRole) {
+			return writeErr(r, http.StatusBadRequest, services.ErrBadRole)
+		}
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	userResp := &models.UserResponse{Username: username}
+	return writeJSON(w, http.StatusOK, userResp)
+}
+
+func (s *Server) deleteUser(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.deleteUser"
+	log := s.log.With(slog.String("op", op))
+
+	username := r.PathValue("username")
+
+	if err := s.auth.DeleteUser(r.Context(), username); err != nil {
+		log.Error("Не удалось удалить пользователя",
+			slog.String("error", err.Error()))
+		if errors.Is(err, kvstore.ErrUserNotFound) {
+			return writeErr(r, http.StatusNotFound, kvstore.ErrUserNotFound)
+		}
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	userResp := &models.UserResponse{Username: username}
+	return writeJSON(w, http.StatusOK, userResp)
+}
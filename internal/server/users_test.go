@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"vk-intern/internal/config"
+	"vk-intern/internal/models"
+)
+
+func TestUsers(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+
+	user := models.CreateUserRequest{Username: "bob", Password: "secret"}
+	resp, body := ts.admin(t, http.MethodPost, "/api/users", user, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	resp, body = ts.admin(t, http.MethodPost, "/api/users", user, nil)
+	wantStatus(t, resp, body, http.StatusConflict)
+
+	resp, body = ts.admin(t, http.MethodPost, "/api/users", models.CreateUserRequest{
+		Username: "eve", Password: "secret", Roles: []string{"root"},
+	}, nil)
+	wantStatus(t, resp, body, http.StatusBadRequest)
+
+	resp, body = ts.admin(t, http.MethodGet, "/api/users", nil, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	usersResp := &models.UsersResponse{}
+	decode(t, body, usersResp)
+	names := make([]string, 0, len(usersResp.Users))
+	for _, u := range usersResp.Users {
+		names = append(names, u.Username)
+		if u.Username == "bob" && !slices.Equal(u.Roles, []string{models.RoleReader}) {
+			t.Errorf("роли по умолчанию %v, want [reader]", u.Roles)
+		}
+	}
+	slices.Sort(names)
+	if !slices.Equal(names, []string{"admin", "bob"}) {
+		t.Errorf("пользователи %v, want [admin bob]", names)
+	}
+
+	resp, body = ts.admin(t, http.MethodPut, "/api/users/bob", models.UpdateUserRequest{Password: "changed"}, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	ts.login(t, "bob", "changed")
+
+	resp, body = ts.admin(t, http.MethodPut, "/api/users/none", models.UpdateUserRequest{Password: "x"}, nil)
+	wantStatus(t, resp, body, http.StatusNotFound)
+
+	resp, body = ts.admin(t, http.MethodDelete, "/api/users/bob", nil, nil)
+	wantStatus(t, resp, body, http.StatusOK)
+	resp, body = ts.admin(t, http.MethodDelete, "/api/users/bob", nil, nil)
+	wantStatus(t, resp, body, http.StatusNotFound)
+}
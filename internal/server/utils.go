@@ -2,7 +2,12 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
 )
 
 type errResp struct {
@@ -24,8 +29,80 @@ func writeErr(r *http.Request, statusCode int, err error) error {
 	return err
 }
 
+// decodeErr возвращает 413, если тело запроса больше допустимого размера,
+// и 400 с ошибкой badReq для остальных ошибок разбора
+func decodeErr(r *http.Request, err, badReq error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return writeErr(r, http.StatusRequestEntityTooLarge, ErrBodyTooLarge)
+	}
+	return writeErr(r, http.StatusBadRequest, badReq)
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) error {
 	w.WriteHeader(status)
 	w.Header().Set("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(v)
 }
+
+// clientIP возвращает IP-адрес клиента без порта. Если запрос пришел
+// от доверенного прокси, адрес берется из X-Forwarded-For: адреса перебираются
+// справа налево, и первый адрес не из доверенных подсетей считается адресом клиента.
+func (s *Server) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !s.trusted(addr) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+
+		host = addr.Unmap().String()
+		if !s.trusted(addr) {
+			break
+		}
+	}
+
+	return host
+}
+
+func (s *Server) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies разбирает адреса и подсети доверенных прокси
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("некорректный адрес доверенного прокси %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("некорректная подсеть доверенного прокси %q: %w", proxy, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{trustedProxies: proxies}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{name: "без прокси", remoteAddr: "1.2.3.4:5000", want: "1.2.3.4"},
+		{
+			name:       "заголовок от недоверенного адреса",
+			remoteAddr: "1.2.3.4:5000",
+			forwarded:  []string{"5.6.7.8"},
+			want:       "1.2.3.4",
+		},
+		{
+			name:       "доверенный прокси",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  []string{"5.6.7.8"},
+			want:       "5.6.7.8",
+		},
+		{
+			name:       "адрес прокси без подсети",
+			remoteAddr: "192.168.1.1:5000",
+			forwarded:  []string{"5.6.7.8"},
+			want:       "5.6.7.8",
+		},
+		{
+			name:       "цепочка доверенных прокси",
+			remoteAddr: "10.0.0.1:5000",
+			forwarded:  []string{"5.6.7.8, 10.0.0.2"},
+			want:       "5.6.7.8",
+		},
+		{
+			name:       "подделанный адрес слева от клиента",
+			remoteAddr: "10.0.0.1:5000",
+			forwarded:  []string{"9.9.9.9, 5.6.7.8"},
+			want:       "5.6.7.8",
+		},
+		{
+			name:       "несколько заголовков",
+			remoteAddr: "10.0.0.1:5000",
+			forwarded:  []string{"5.6.7.8", "10.0.0.2"},
+			want:       "5.6.7.8",
+		},
+		{
+			name:       "все адреса доверенные",
+			remoteAddr: "10.0.0.1:5000",
+			forwarded:  []string{"10.0.0.3, 10.0.0.2"},
+			want:       "10.0.0.3",
+		},
+		{
+			name:       "некорректный адрес в заголовке",
+			remoteAddr: "10.0.0.1:5000",
+			forwarded:  []string{"5.6.7.8, unknown"},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "прокси без заголовка",
+			remoteAddr: "10.0.0.1:5000",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "IPv6 клиента",
+			remoteAddr: "10.0.0.1:5000",
+			forwarded:  []string{"2001:db8::1"},
+			want:       "2001:db8::1",
+		},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/api/login", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for _, v := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+
+		if got := s.clientIP(r); got != tt.want {
+			t.Errorf("%s: clientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, bad := range []string{"proxy", "10.0.0.0/33", "10.0.0"} {
+		if _, err := parseTrustedProxies([]string{bad}); err == nil {
+			t.Errorf("parseTrustedProxies(%q) без ошибки", bad)
+		}
+	}
+
+	prefixes, err := parseTrustedProxies([]string{"10.0.0.1/8", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := prefixes[0].String(); got != "10.0.0.0/8" {
+		t.Errorf("подсеть %s, want 10.0.0.0/8", got)
+	}
+	if got := prefixes[1].String(); got != "::1/128" {
+		t.Errorf("адрес %s, want ::1/128", got)
+	}
+}
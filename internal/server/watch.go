@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"vk-intern/internal/services"
+)
+
+// Период комментариев-пингов, чтобы прокси не закрывали простаивающее соединение
+const watchPing = 15 * time.Second
+
+// watch передает изменения ключей как Server-Sent Events.
+// Каждое событие имеет тип put или delete и данные {"key", "value", "version", "op"}.
+// Если часть изменений не может быть передана, поток завершается событием error
+// с данными {"error"}, после которого клиенту нужно перечитать ключи.
+func (s *Server) watch(w http.ResponseWriter, r *http.Request) error {
+	const op = "server.watch"
+	log := s.log.With(slog.String("op", op))
+
+	query := r.URL.Query()
+	var keys []string
+	if k := query.Get("keys"); k != "" {
+		keys = strings.Split(k, ",")
+	}
+
+	if len(keys) == 0 && !query.Has("prefix") {
+		log.Error("Не указаны ключи или префикс")
+		return writeErr(r, http.StatusBadRequest, ErrBadReq)
+	}
+
+	if err := s.checkKeys(r, keys); err != nil {
+		log.Error("Запрос превышает ограничения", slog.String("error", err.Error()))
+		return err
+	}
+	if err := s.checkKey(r, query.Get("prefix")); err != nil {
+		log.Error("Запрос превышает ограничения", slog.String("error", err.Error()))
+		return err
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Error("Соединение не поддерживает потоковую передачу")
+		return writeErr(r, http.StatusInternalServerError, services.ErrInternal)
+	}
+
+	events, err := s.storage.Watch(r.Context(), keys, query.Get("prefix"))
+	if err != nil {
+		log.Error("Не удалось подписаться на изменения",
+			slog.String("error", err.Error()))
+		return writeErr(r, http.StatusInternalServerError, err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ping := time.NewTicker(watchPing)
+	defer ping.Stop()
+
+	log.Info("Передача изменений ключей")
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Info("Клиент отключился")
+			return nil
+		case <-s.shutdown:
+			log.Info("Сервер останавливается")
+			return nil
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event, ok := <-events:
+			if !ok {
+				// Хранилище закрывает подписку при остановке и при потере событий
+				log.Error("Подписка завершена хранилищем")
+				writeWatchLost(w, flusher)
+				return nil
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Error("Не удалось преобразовать событие",
+					slog.String("error", err.Error()))
+				writeWatchLost(w, flusher)
+				return nil
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Op, data)
+		}
+		flusher.Flush()
+	}
+}
+
+// writeWatchLost завершает поток событием error, чтобы клиент перечитал ключи
+func writeWatchLost(w http.ResponseWriter, flusher http.Flusher) {
+	data, _ := json.Marshal(errResp{Error: ErrWatchLost.Error()})
+	fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+	flusher.Flush()
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"vk-intern/internal/config"
+	"vk-intern/internal/models"
+)
+
+func TestWatch(t *testing.T) {
+	ts := newTestServer(t, config.LimitsConfig{})
+
+	resp, body := ts.admin(t, http.MethodGet, "/api/watch", nil, nil)
+	wantStatus(t, resp, body, http.StatusBadRequest)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/watch?prefix=cfg:", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+ts.token)
+	stream, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	if ct := stream.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type %q, want text/event-stream", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stream.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	resp, body = ts.admin(t, http.MethodPost, "/api/write", models.WriteRequest{
+		Data: models.Data{"other": 1, "cfg:a": 2},
+	}, nil)
+	wantStatus(t, resp, body, http.StatusCreated)
+
+	// Ключ без префикса не передается, поэтому первое событие - cfg:a
+	want := []string{"event: put", `data: {"key":"cfg:a","value":2,"version":`}
+	timeout := time.After(5 * time.Second)
+	for len(want) != 0 {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("поток закрыт до события")
+			}
+			if line == "" || strings.HasPrefix(line, ":") {
+				continue
+			}
+			if !strings.HasPrefix(line, want[0]) {
+				t.Fatalf("строка %q, want %q", line, want[0])
+			}
+			want = want[1:]
+		case <-timeout:
+			t.Fatalf("не получено %q", want[0])
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"vk-intern/internal/kvstore"
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
+)
+
+// ListGrants возвращает все правила доступа
+func (a *Auth) ListGrants(ctx context.Context) ([]*models.Grant, error) {
+	const op = "service.ListGrants"
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("Получение правил доступа")
+	grants, err := a.kvStore.ListGrants(ctx, nil)
+	if err != nil {
+		log.Error("Ошибка при получении правил доступа",
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	log.Info("Правила доступа получены")
+	return grants, nil
+}
+
+// PutGrant создает правило доступа или заменяет права существующего
+func (a *Auth) PutGrant(ctx context.Context, grant *models.Grant) error {
+	const op = "service.PutGrant"
+	log := a.log.With(slog.String("op", op))
+
+	if !models.ValidSubject(grant.Subject) {
+		log.Error("Некорректный субъект", slog.String("subject", grant.Subject))
+		return fmt.Errorf("%s: %w", op, services.ErrBadSubject)
+	}
+
+	log.Info("Сохранение правила доступа")
+	if err := a.kvStore.PutGrant(ctx, grant); err != nil {
+		log.Error("Ошибка при сохранении правила доступа",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	log.Info("Правило доступа сохранено")
+	return nil
+}
+
+func (a *Auth) DeleteGrant(ctx context.Context, subject, prefix string) error {
+	const op = "service.DeleteGrant"
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("Удаление правила доступа")
+	if err := a.kvStore.DeleteGrant(ctx, subject, prefix); err != nil {
+		if errors.Is(err, kvstore.ErrGrantNotFound) {
+			log.Error("Правило доступа не найдено")
+			return fmt.Errorf("%s: %w", op, kvstore.ErrGrantNotFound)
+		}
+
+		log.Error("Ошибка при удалении правила доступа",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	log.Info("Правило доступа удалено")
+	return nil
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"vk-intern/internal/kvstore"
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
+)
+
+const (
+	apiKeyIDLen     = 8
+	apiKeySecretLen = 32
+
+	// Время последнего использования ключа обновляется не чаще этого периода,
+	// чтобы не записывать в БД при каждом запросе
+	apiKeyTouchInterval = time.Minute
+)
+
+// CreateAPIKey создает API-ключ пользователя identity и возвращает его вместе с открытым ключом.
+// Ключ имеет вид <id>.<secret>, в БД сохраняется только хеш.
+// Роли ключа не могут быть старше ролей пользователя, по умолчанию ключ получает все его роли.
+func (a *Auth) CreateAPIKey(ctx context.Context,
+	identity *services.Identity, name string, roles []string,
+) (*models.APIKey, string, error) {
+	const op = "service.CreateAPIKey"
+	log := a.log.With(slog.String("op", op))
+
+	if roles == nil {
+		roles = identity.Roles
+	}
+
+	if len(roles) == 0 || !validRoles(roles) {
+		log.Error("Неизвестная роль", slog.Any("roles", roles))
+		return nil, "", fmt.Errorf("%s: %w", op, services.ErrBadRole)
+	}
+
+	for _, role := range roles {
+		if !models.HasRole(identity.Roles, role) {
+			log.Error("Роль ключа старше роли пользователя", slog.String("role", role))
+			return nil, "", fmt.Errorf("%s: %w", op, services.ErrRoleNotAllowed)
+		}
+	}
+
+	id, err := randomString(apiKeyIDLen, hex.EncodeToString)
+	if err != nil {
+		log.Error("Не удалось создать идентификатор ключа",
+			slog.String("error", err.Error()))
+		return nil, "", fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	secret, err := randomString(apiKeySecretLen, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		log.Error("Не удалось создать ключ",
+			slog.String("error", err.Error()))
+		return nil, "", fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	key := &models.APIKey{
+		ID:        id,
+		Username:  identity.Username,
+		Hash:      hashAPIKey(secret),
+		Name:      name,
+		Roles:     roles,
+		CreatedAt: uint64(time.Now().Unix()),
+	}
+
+	log.Info("Сохранение API-ключа", slog.String("id", id))
+	if err := a.kvStore.CreateAPIKey(ctx, key); err != nil {
+		log.Error("Ошибка при сохранении API-ключа",
+			slog.String("error", err.Error()))
+		return nil, "", fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	log.Info("API-ключ создан")
+	return key, id + "." + secret, nil
+}
+
+// ListAPIKeys возвращает ключи пользователя без хешей
+func (a *Auth) ListAPIKeys(ctx context.Context, username string) ([]*models.APIKey, error) {
+	const op = "service.ListAPIKeys"
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("Получение API-ключей")
+	keys, err := a.kvStore.ListAPIKeys(ctx, username)
+	if err != nil {
+		log.Error("Ошибка при получении API-ключей",
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	for _, key := range keys {
+		key.Hash = ""
+	}
+
+	log.Info("API-ключи получены")
+	return keys, nil
+}
+
+// DeleteAPIKey отзывает ключ. Пользователь может отозвать только свои ключи,
+// администратор - любые. Чужой ключ считается ненайденным.
+func (a *Auth) DeleteAPIKey(ctx context.Context, identity *services.Identity, id string) error {
+	const op = "service.DeleteAPIKey"
+	log := a.log.With(slog.String("op", op))
+
+	key, err := a.kvStore.GetAPIKey(ctx, id)
+	if err != nil {
+		if errors.Is(err, kvstore.ErrAPIKeyNotFound) {
+			log.Error("API-ключ не найден")
+			return fmt.Errorf("%s: %w", op, kvstore.ErrAPIKeyNotFound)
+		}
+
+		log.Error("Ошибка при получении API-ключа",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	if key.Username != identity.Username && !models.HasRole(identity.Roles, models.RoleAdmin) {
+		log.Error("API-ключ принадлежит другому пользователю")
+		return fmt.Errorf("%s: %w", op, kvstore.ErrAPIKeyNotFound)
+	}
+
+	log.Info("Удаление API-ключа")
+	if err := a.kvStore.DeleteAPIKey(ctx, id); err != nil {
+		if errors.Is(err, kvstore.ErrAPIKeyNotFound) {
+			log.Error("API-ключ не найден")
+			return fmt.Errorf("%s: %w", op, kvstore.ErrAPIKeyNotFound)
+		}
+
+		log.Error("Ошибка при удалении API-ключа",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	log.Info("API-ключ удален")
+	return nil
+}
+
+// CheckAPIKey проверяет ключ и возвращает пользователя, от имени которого выполняется запрос.
+// Роли ограничиваются текущими ролями владельца ключа.
+func (a *Auth) CheckAPIKey(ctx context.Context, apiKey string) (*services.Identity, error) {
+	const op = "service.CheckAPIKey"
+	log := a.log.With(slog.String("op", op))
+
+	id, secret, ok := strings.Cut(apiKey, ".")
+	if !ok || id == "" || secret == "" {
+		log.Error("Некорректный формат API-ключа")
+		return nil, fmt.Errorf("%s: %w", op, services.ErrBadAPIKey)
+	}
+
+	key, err := a.kvStore.GetAPIKey(ctx, id)
+	if err != nil {
+		log.Error("Ошибка при получении API-ключа",
+			slog.String("error", err.Error()))
+		if errors.Is(err, kvstore.ErrAPIKeyNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, services.ErrBadAPIKey)
+		}
+		return nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashAPIKey(secret))) != 1 {
+		log.Error("Неверный API-ключ", slog.String("id", id))
+		return nil, fmt.Errorf("%s: %w", op, services.ErrBadAPIKey)
+	}
+
+	user, err := a.kvStore.GetUser(ctx, key.Username)
+	if err != nil {
+		log.Error("Владелец API-ключа не найден",
+			slog.String("error", err.Error()))
+		if errors.Is(err, kvstore.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, services.ErrBadAPIKey)
+		}
+		return nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	roles := make([]string, 0, len(key.Roles))
+	for _, role := range key.Roles {
+		if models.HasRole(user.Roles, role) {
+			roles = append(roles, role)
+		}
+	}
+
+	// Ошибка обновления времени использования не мешает запросу
+	now := time.Now()
+	if now.Sub(time.Unix(int64(key.LastUsed), 0)) >= apiKeyTouchInterval {
+		if err := a.kvStore.TouchAPIKey(ctx, id, uint64(now.Unix())); err != nil {
+			log.Error("Не удалось сохранить время использования API-ключа",
+				slog.String("error", err.Error()))
+		}
+	}
+
+	return &services.Identity{Username: user.Username, Roles: roles}, nil
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encode(b), nil
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"vk-intern/internal/config"
+	"vk-intern/internal/kvstore/memory"
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
+)
+
+func newTestAuth(t *testing.T) (*Auth, *memory.Memory) {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	kvStore := memory.New(log)
+	t.Cleanup(kvStore.Stop)
+
+	return New(log, kvStore, &config.LoginConfig{}), kvStore
+}
+
+// newTestKey создает пользователя с ролями userRoles и его API-ключ с ролями keyRoles
+func newTestKey(t *testing.T, a *Auth, userRoles, keyRoles []string) (*models.APIKey, string) {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := a.CreateUser(ctx, "bob", "secret", userRoles); err != nil {
+		t.Fatal(err)
+	}
+
+	identity := &services.Identity{Username: "bob", Roles: userRoles}
+	key, apiKey, err := a.CreateAPIKey(ctx, identity, "ci", keyRoles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, apiKey
+}
+
+func TestCreateAPIKeyStoresHash(t *testing.T) {
+	a, kvStore := newTestAuth(t)
+	key, apiKey := newTestKey(t, a, []string{models.RoleWriter}, nil)
+
+	id, secret, ok := strings.Cut(apiKey, ".")
+	if !ok || id != key.ID {
+		t.Fatalf("ключ %q, want <%s>.<secret>", apiKey, key.ID)
+	}
+
+	stored, err := kvStore.GetAPIKey(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Hash != hashAPIKey(secret) || strings.Contains(stored.Hash, secret) {
+		t.Errorf("сохранен %q, want только хеш ключа", stored.Hash)
+	}
+	if !slices.Equal(stored.Roles, []string{models.RoleWriter}) {
+		t.Errorf("роли ключа %v, want роли пользователя", stored.Roles)
+	}
+}
+
+func TestCreateAPIKeyRoles(t *testing.T) {
+	a, _ := newTestAuth(t)
+	identity := &services.Identity{Username: "bob", Roles: []string{models.RoleWriter}}
+
+	tests := []struct {
+		name  string
+		roles []string
+		want  error
+	}{
+		{name: "роль старше роли пользователя", roles: []string{models.RoleAdmin}, want: services.ErrRoleNotAllowed},
+		{name: "неизвестная роль", roles: []string{"root"}, want: services.ErrBadRole},
+		{name: "пустой список ролей", roles: []string{}, want: services.ErrBadRole},
+	}
+
+	for _, tt := range tests {
+		if _, _, err := a.CreateAPIKey(context.Background(), identity, "ci", tt.roles); !errors.Is(err, tt.want) {
+			t.Errorf("%s: ошибка %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestCheckAPIKey(t *testing.T) {
+	a, _ := newTestAuth(t)
+	key, apiKey := newTestKey(t, a, []string{models.RoleWriter}, nil)
+
+	identity, err := a.CheckAPIKey(context.Background(), apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Username != "bob" || !slices.Equal(identity.Roles, []string{models.RoleWriter}) {
+		t.Errorf("пользователь %+v, want bob с ролью writer", identity)
+	}
+
+	bad := []string{"", "no-dot", "." + apiKey, key.ID + ".", key.ID + ".wrong", "unknown." + apiKey}
+	for _, k := range bad {
+		if _, err := a.CheckAPIKey(context.Background(), k); !errors.Is(err, services.ErrBadAPIKey) {
+			t.Errorf("ключ %q: ошибка %v, want %v", k, err, services.ErrBadAPIKey)
+		}
+	}
+}
+
+func TestCheckAPIKeyClampsRoles(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+	_, apiKey := newTestKey(t, a, []string{models.RoleWriter}, []string{models.RoleReader, models.RoleWriter})
+
+	// Роли ключа ограничиваются текущими ролями владельца
+	if err := a.UpdateUser(ctx, "bob", "", []string{models.RoleReader}); err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := a.CheckAPIKey(ctx, apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(identity.Roles, []string{models.RoleReader}) {
+		t.Errorf("роли %v, want [reader]", identity.Roles)
+	}
+}
+
+func TestCheckAPIKeyTouch(t *testing.T) {
+	a, kvStore := newTestAuth(t)
+	ctx := context.Background()
+	key, apiKey := newTestKey(t, a, []string{models.RoleReader}, nil)
+
+	lastUsed := func() uint64 {
+		t.Helper()
+		stored, err := kvStore.GetAPIKey(ctx, key.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stored.LastUsed
+	}
+
+	if _, err := a.CheckAPIKey(ctx, apiKey); err != nil {
+		t.Fatal(err)
+	}
+	if lastUsed() == 0 {
+		t.Fatal("время использования не сохранено")
+	}
+
+	// Недавнее время использования не перезаписывается при каждом запросе
+	recent := uint64(time.Now().Add(-10 * time.Second).Unix())
+	if err := kvStore.TouchAPIKey(ctx, key.ID, recent); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CheckAPIKey(ctx, apiKey); err != nil {
+		t.Fatal(err)
+	}
+	if got := lastUsed(); got != recent {
+		t.Errorf("время использования %d, want без изменений %d", got, recent)
+	}
+
+	old := uint64(time.Now().Add(-2 * apiKeyTouchInterval).Unix())
+	if err := kvStore.TouchAPIKey(ctx, key.ID, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CheckAPIKey(ctx, apiKey); err != nil {
+		t.Fatal(err)
+	}
+	if got := lastUsed(); got <= old {
+		t.Errorf("время использования %d, want обновлено после %d", got, old)
+	}
+}
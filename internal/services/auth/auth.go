@@ -2,79 +2,173 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
+	"vk-intern/internal/config"
 	"vk-intern/internal/jwt"
 	"vk-intern/internal/kvstore"
 	"vk-intern/internal/models"
 	"vk-intern/internal/services"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
+// dummyHash сравнивается с паролем, если пользователь не найден, чтобы ответ
+// для несуществующего пользователя занимал столько же времени, сколько
+// для неверного пароля, и по времени нельзя было подобрать имена пользователей.
+// Стоимость совпадает с bcrypt.DefaultCost, с которой хешируются пароли.
+const dummyHash = "$2a$10$oqbX6aywEEp2ngMKPiOyVOm/9mjknrMqR7YCZHmLfthQMQPyLvpRq"
+
 type KVStore interface {
 	GetUser(ctx context.Context, username string) (*models.User, error)
+	CreateUser(ctx context.Context, user *models.User) error
+	ListUsers(ctx context.Context) ([]*models.User, error)
+	UpdateUser(ctx context.Context, user *models.User) error
+	DeleteUser(ctx context.Context, username string) error
+
+	RevokeToken(ctx context.Context, id string, expiresAt uint64) error
+	IsTokenRevoked(ctx context.Context, id string) (bool, error)
+
+	ListGrants(ctx context.Context, subjects []string) ([]*models.Grant, error)
+	PutGrant(ctx context.Context, grant *models.Grant) error
+	DeleteGrant(ctx context.Context, subject, prefix string) error
+
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	GetAPIKey(ctx context.Context, id string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context, username string) ([]*models.APIKey, error)
+	TouchAPIKey(ctx context.Context, id string, usedAt uint64) error
+	DeleteAPIKey(ctx context.Context, id string) error
+
+	LoginFailed(ctx context.Context, subject string, policy *models.LockoutPolicy) (uint64, error)
+	LoginLockedUntil(ctx context.Context, subjects []string) (uint64, error)
+	ResetLoginFailures(ctx context.Context, subject string) error
 }
 
 type Auth struct {
 	log     *slog.Logger
 	kvStore KVStore
+	lockout *config.LoginConfig
 }
 
-func New(log *slog.Logger, kvStore KVStore) *Auth {
+func New(log *slog.Logger, kvStore KVStore, lockout *config.LoginConfig) *Auth {
 	return &Auth{
 		log:     log,
 		kvStore: kvStore,
+		lockout: lockout,
 	}
 }
 
-func (a *Auth) FindUser(ctx context.Context, username string) error {
-	const op = "service.Login"
+// FindUser возвращает текущие роли пользователя или ErrUserNotFound, если его нет
+func (a *Auth) FindUser(ctx context.Context, username string) ([]string, error) {
+	const op = "service.FindUser"
 	log := a.log.With(slog.String("op", op))
 
 	log.Info("Проверка на существование пользователя")
-	if _, err := a.kvStore.GetUser(ctx, username); err != nil {
+	user, err := a.kvStore.GetUser(ctx, username)
+	if err != nil {
 		if errors.Is(err, kvstore.ErrUserNotFound) {
 			log.Error("Пользователь не найден")
-			return fmt.Errorf("%s: %w", op, kvstore.ErrUserNotFound)
+			return nil, fmt.Errorf("%s: %w", op, kvstore.ErrUserNotFound)
 		}
 
 		log.Error("Ошибка при проверки пользователя",
 			slog.String("error", err.Error()))
-		return fmt.Errorf("%s: %w", op, services.ErrInternal)
+		return nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
 	}
 
 	log.Info("Пользователь найден")
-	return nil
+	return user.Roles, nil
 }
 
-func (a *Auth) Login(ctx context.Context, secret string,
-	username, password string, duration time.Duration,
-) (string, error) {
+// Login проверяет логин и пароль и выдает токены. Неудачные попытки считаются
+// для пользователя и IP-адреса ip, при превышении лимита возвращается LockedError.
+func (a *Auth) Login(ctx context.Context, keys *jwt.Keys,
+	username, password, ip string, duration, refreshDuration time.Duration,
+) (string, string, error) {
 	const op = "service.Login"
 	log := a.log.With(slog.String("op", op))
 
+	if err := a.checkLockout(ctx, username, ip); err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
 	log.Info("Проверка пользователя")
 	user, err := a.kvStore.GetUser(ctx, username)
 	if err != nil {
 		if errors.Is(err, kvstore.ErrUserNotFound) {
 			log.Error("Пользователя с таким именем не существует")
-			return "", fmt.Errorf("%s: %w", op, kvstore.ErrUserNotFound)
+			checkPassword(dummyHash, password)
+			a.loginFailed(ctx, username, ip)
+			return "", "", fmt.Errorf("%s: %w", op, services.ErrInvalidCredentials)
 		}
 
 		log.Error("Ошибка при получении пользователя",
 			slog.String("error", err.Error()))
-		return "", fmt.Errorf("%s: %w", op, services.ErrInternal)
+		return "", "", fmt.Errorf("%s: %w", op, services.ErrInternal)
 	}
 
-	if user.Password != password {
+	if !checkPassword(user.Password, password) {
 		log.Error("Неправильный пароль")
-		return "", fmt.Errorf("%s: %s", op, "Неправильный логин или пароль")
+		a.loginFailed(ctx, username, ip)
+		return "", "", fmt.Errorf("%s: %w", op, services.ErrInvalidCredentials)
+	}
+	a.loginSucceeded(ctx, username)
+
+	// Пароли, сохраненные открытым текстом, заменяются хешем при входе
+	if !isHash(user.Password) {
+		a.upgradePassword(ctx, username, password)
+	}
+
+	log.Info("Создание токенов")
+	token, err := jwt.NewToken(username, user.Roles, keys, jwt.TypeAccess, duration)
+	if err != nil {
+		log.Error("Не удалось создать токен",
+			slog.String("error", err.Error()))
+		return "", "", fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	refreshToken, err := jwt.NewToken(username, nil, keys, jwt.TypeRefresh, refreshDuration)
+	if err != nil {
+		log.Error("Не удалось создать токен обновления",
+			slog.String("error", err.Error()))
+		return "", "", fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+	log.Info("Токены успешно созданы")
+
+	return token, refreshToken, nil
+}
+
+// Refresh выдает новый токен доступа по действующему токену обновления
+func (a *Auth) Refresh(ctx context.Context, keys *jwt.Keys,
+	refreshToken string, duration time.Duration,
+) (string, error) {
+	const op = "service.Refresh"
+	log := a.log.With(slog.String("op", op))
+
+	claims, err := a.ParseToken(ctx, keys, refreshToken, jwt.TypeRefresh)
+	if err != nil {
+		log.Error("Токен обновления не прошел проверку",
+			slog.String("error", err.Error()))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Роли берутся из БД, чтобы их изменения применялись при обновлении токена
+	user, err := a.kvStore.GetUser(ctx, claims.Username)
+	if err != nil {
+		log.Error("Пользователь токена не найден",
+			slog.String("error", err.Error()))
+		if errors.Is(err, kvstore.ErrUserNotFound) {
+			return "", fmt.Errorf("%s: %w", op, kvstore.ErrUserNotFound)
+		}
+		return "", fmt.Errorf("%s: %w", op, services.ErrInternal)
 	}
 
 	log.Info("Создание токена")
-	token, err := jwt.NewToken(username, secret, duration)
+	token, err := jwt.NewToken(user.Username, user.Roles, keys, jwt.TypeAccess, duration)
 	if err != nil {
 		log.Error("Не удалось создать токен",
 			slog.String("error", err.Error()))
@@ -84,3 +178,249 @@ func (a *Auth) Login(ctx context.Context, secret string,
 
 	return token, nil
 }
+
+// ParseToken проверяет подпись, срок действия и тип токена,
+// а также что токен не был отозван
+func (a *Auth) ParseToken(ctx context.Context,
+	keys *jwt.Keys, token, typ string,
+) (*jwt.Claims, error) {
+	const op = "service.ParseToken"
+	log := a.log.With(slog.String("op", op))
+
+	claims, err := jwt.ParseJWT(token, keys)
+	if err != nil {
+		log.Error("Ошибка проверки токена", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, services.ErrBadToken)
+	}
+
+	if claims.Type != typ {
+		log.Error("Неверный тип токена", slog.String("type", claims.Type))
+		return nil, fmt.Errorf("%s: %w", op, services.ErrBadToken)
+	}
+
+	revoked, err := a.kvStore.IsTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		log.Error("Ошибка при проверке отзыва токена",
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	if revoked {
+		log.Error("Токен отозван", slog.String("jti", claims.ID))
+		return nil, fmt.Errorf("%s: %w", op, services.ErrTokenRevoked)
+	}
+
+	return claims, nil
+}
+
+// Logout отзывает токен доступа и, если передан, токен обновления того же пользователя
+func (a *Auth) Logout(ctx context.Context, keys *jwt.Keys,
+	access *jwt.Claims, refreshToken string,
+) error {
+	const op = "service.Logout"
+	log := a.log.With(slog.String("op", op))
+
+	revoke := []*jwt.Claims{access}
+	if refreshToken != "" {
+		refresh, err := a.ParseToken(ctx, keys, refreshToken, jwt.TypeRefresh)
+		if err != nil {
+			log.Error("Токен обновления не прошел проверку",
+				slog.String("error", err.Error()))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if refresh.Username != access.Username {
+			log.Error("Токен обновления выдан другому пользователю")
+			return fmt.Errorf("%s: %w", op, services.ErrBadToken)
+		}
+		revoke = append(revoke, refresh)
+	}
+
+	for _, claims := range revoke {
+		log.Info("Отзыв токена", slog.String("jti", claims.ID))
+		expiresAt := uint64(claims.ExpiresAt.Unix())
+		if err := a.kvStore.RevokeToken(ctx, claims.ID, expiresAt); err != nil {
+			log.Error("Не удалось отозвать токен",
+				slog.String("error", err.Error()))
+			return fmt.Errorf("%s: %w", op, services.ErrInternal)
+		}
+	}
+
+	log.Info("Токены отозваны")
+	return nil
+}
+
+func (a *Auth) CreateUser(ctx context.Context,
+	username, password string, roles []string,
+) error {
+	const op = "service.CreateUser"
+	log := a.log.With(slog.String("op", op))
+
+	if len(roles) == 0 {
+		roles = []string{models.RoleReader}
+	}
+	if !validRoles(roles) {
+		log.Error("Неизвестная роль", slog.Any("roles", roles))
+		return fmt.Errorf("%s: %w", op, services.ErrBadRole)
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		log.Error("Не удалось получить хеш пароля",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	log.Info("Создание пользователя")
+	user := &models.User{Username: username, Password: hash, Roles: roles}
+	if err := a.kvStore.CreateUser(ctx, user); err != nil {
+		if errors.Is(err, kvstore.ErrUserExists) {
+			log.Error("Пользователь уже существует")
+			return fmt.Errorf("%s: %w", op, kvstore.ErrUserExists)
+		}
+
+		log.Error("Ошибка при создании пользователя",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	log.Info("Пользователь создан")
+	return nil
+}
+
+func (a *Auth) ListUsers(ctx context.Context) ([]*models.User, error) {
+	const op = "service.ListUsers"
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("Получение списка пользователей")
+	users, err := a.kvStore.ListUsers(ctx)
+	if err != nil {
+		log.Error("Ошибка при получении пользователей",
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	// Пароли наружу не отдаются
+	for _, user := range users {
+		user.Password = ""
+	}
+
+	log.Info("Список пользователей получен")
+	return users, nil
+}
+
+// UpdateUser меняет пароль и/или роли пользователя, пустые значения не изменяются
+func (a *Auth) UpdateUser(ctx context.Context,
+	username, password string, roles []string,
+) error {
+	const op = "service.UpdateUser"
+	log := a.log.With(slog.String("op", op))
+
+	if roles != nil && (len(roles) == 0 || !validRoles(roles)) {
+		log.Error("Неизвестная роль", slog.Any("roles", roles))
+		return fmt.Errorf("%s: %w", op, services.ErrBadRole)
+	}
+
+	user := &models.User{Username: username, Roles: roles}
+	if password != "" {
+		hash, err := hashPassword(password)
+		if err != nil {
+			log.Error("Не удалось получить хеш пароля",
+				slog.String("error", err.Error()))
+			return fmt.Errorf("%s: %w", op, services.ErrInternal)
+		}
+		user.Password = hash
+	}
+
+	log.Info("Обновление пользователя")
+	if err := a.kvStore.UpdateUser(ctx, user); err != nil {
+		if errors.Is(err, kvstore.ErrUserNotFound) {
+			log.Error("Пользователь не найден")
+			return fmt.Errorf("%s: %w", op, kvstore.ErrUserNotFound)
+		}
+
+		log.Error("Ошибка при обновлении пользователя",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	log.Info("Пользователь обновлен")
+	return nil
+}
+
+func (a *Auth) DeleteUser(ctx context.Context, username string) error {
+	const op = "service.DeleteUser"
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("Удаление пользователя")
+	if err := a.kvStore.DeleteUser(ctx, username); err != nil {
+		if errors.Is(err, kvstore.ErrUserNotFound) {
+			log.Error("Пользователь не найден")
+			return fmt.Errorf("%s: %w", op, kvstore.ErrUserNotFound)
+		}
+
+		log.Error("Ошибка при удалении пользователя",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	log.Info("Пользователь удален")
+	return nil
+}
+
+func (a *Auth) upgradePassword(ctx context.Context, username, password string) {
+	const op = "service.upgradePassword"
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("Замена пароля на хеш")
+	hash, err := hashPassword(password)
+	if err != nil {
+		log.Error("Не удалось получить хеш пароля",
+			slog.String("error", err.Error()))
+		return
+	}
+
+	// Ошибка не мешает входу, пароль будет обновлен при следующем входе
+	user := &models.User{Username: username, Password: hash}
+	if err := a.kvStore.UpdateUser(ctx, user); err != nil {
+		log.Error("Не удалось сохранить хеш пароля",
+			slog.String("error", err.Error()))
+		return
+	}
+	log.Info("Пароль заменен на хеш")
+}
+
+func validRoles(roles []string) bool {
+	for _, role := range roles {
+		if !models.ValidRole(role) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// isHash проверяет, что пароль сохранен в виде bcrypt-хеша
+func isHash(stored string) bool {
+	_, err := bcrypt.Cost([]byte(stored))
+	return err == nil
+}
+
+// checkPassword сравнивает пароль с сохраненным за постоянное время.
+// Поддерживаются bcrypt-хеши и старые пароли открытым текстом.
+func checkPassword(stored, password string) bool {
+	if isHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	}
+
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+}
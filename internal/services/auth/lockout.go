@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
+)
+
+// loginSubjects возвращает субъектов счетчиков неудачных попыток входа и их ограничения
+func (a *Auth) loginSubjects(username, ip string) map[string]*models.LockoutPolicy {
+	policy := &models.LockoutPolicy{
+		MaxFailures: a.lockout.MaxFailures,
+		BaseDelay:   a.lockout.BaseDelay,
+		MaxDelay:    a.lockout.MaxDelay,
+		Lockout:     a.lockout.Lockout,
+		Window:      a.lockout.Window,
+	}
+
+	subjects := map[string]*models.LockoutPolicy{
+		models.UserSubject(username): policy,
+	}
+	if ip != "" && a.lockout.IPMaxFailures > 0 {
+		ipPolicy := *policy
+		ipPolicy.MaxFailures = a.lockout.IPMaxFailures
+		subjects[models.IPSubject(ip)] = &ipPolicy
+	}
+
+	return subjects
+}
+
+// checkLockout возвращает LockedError, если вход пользователя или с IP-адреса заблокирован
+func (a *Auth) checkLockout(ctx context.Context, username, ip string) error {
+	const op = "service.checkLockout"
+	log := a.log.With(slog.String("op", op))
+
+	subjects := make([]string, 0, 2)
+	for subject := range a.loginSubjects(username, ip) {
+		subjects = append(subjects, subject)
+	}
+
+	lockedUntil, err := a.kvStore.LoginLockedUntil(ctx, subjects)
+	if err != nil {
+		log.Error("Ошибка при проверке блокировки входа",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	if retryAfter := time.Until(time.Unix(int64(lockedUntil), 0)); retryAfter > 0 {
+		log.Error("Вход заблокирован",
+			slog.String("username", username), slog.String("ip", ip))
+		return &services.LockedError{RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+// loginFailed учитывает неудачную попытку входа. Ошибка учета
+// не меняет ответ пользователю, поэтому только логируется.
+func (a *Auth) loginFailed(ctx context.Context, username, ip string) {
+	const op = "service.loginFailed"
+	log := a.log.With(slog.String("op", op))
+
+	for subject, policy := range a.loginSubjects(username, ip) {
+		if _, err := a.kvStore.LoginFailed(ctx, subject, policy); err != nil {
+			log.Error("Не удалось учесть неудачную попытку входа",
+				slog.String("subject", subject), slog.String("error", err.Error()))
+		}
+	}
+}
+
+// loginSucceeded сбрасывает счетчик пользователя. Счетчик IP-адреса
+// не сбрасывается, чтобы вход в свою учетную запись не снимал
+// ограничение на подбор паролей к чужим.
+func (a *Auth) loginSucceeded(ctx context.Context, username string) {
+	const op = "service.loginSucceeded"
+	log := a.log.With(slog.String("op", op))
+
+	if err := a.kvStore.ResetLoginFailures(ctx, models.UserSubject(username)); err != nil {
+		log.Error("Не удалось сбросить счетчик попыток входа",
+			slog.String("error", err.Error()))
+	}
+}
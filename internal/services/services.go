@@ -1,7 +1,64 @@
 package services
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
 var (
-	ErrInternal = errors.New("Внутренняя ошибка")
+	ErrInternal   = errors.New("Внутренняя ошибка")
+	ErrRolledBack = errors.New("Транзакция отменена, данные не записаны")
+	ErrConflict   = errors.New("Версия ключа изменилась")
+	ErrNotNumeric = errors.New("Значение ключа не является числом")
+	ErrNotFound   = errors.New("Ключ не найден")
+
+	ErrBadPatch      = errors.New("Некорректный патч")
+	ErrPatchFailed   = errors.New("Не удалось применить патч к значению ключа")
+	ErrValueTooLarge = errors.New("Значение ключа превышает допустимый размер")
+
+	ErrBadToken           = errors.New("Недействительный токен")
+	ErrTokenRevoked       = errors.New("Токен отозван")
+	ErrBadAPIKey          = errors.New("Недействительный API-ключ")
+	ErrInvalidCredentials = errors.New("Неправильный логин или пароль")
+	ErrLoginLocked        = errors.New("Слишком много неудачных попыток входа, повторите позже")
+
+	ErrBadRole      = errors.New("Неизвестная роль, допустимые роли: reader, writer, admin")
+	ErrBadSubject   = errors.New("Субъект должен иметь вид user:<имя> или role:<роль>")
+	ErrAccessDenied = errors.New("Нет доступа к ключам")
+
+	ErrRoleNotAllowed = errors.New("Роль ключа не может быть старше ролей пользователя")
 )
+
+// LockedError - вход временно заблокирован после неудачных попыток
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return ErrLoginLocked.Error()
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrLoginLocked
+}
+
+// Identity - авторизованный пользователь, от имени которого выполняется запрос
+type Identity struct {
+	Username string
+	Roles    []string
+}
+
+type ctxKey int
+
+const ctxKeyIdentity ctxKey = iota
+
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, ctxKeyIdentity, identity)
+}
+
+// IdentityFromContext возвращает пользователя запроса или nil, если запрос не авторизован
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(ctxKeyIdentity).(*Identity)
+	return identity
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
+)
+
+// acl - права пользователя запроса на префиксы ключей
+type acl struct {
+	admin  bool
+	grants []*models.Grant
+}
+
+// loadACL получает правила доступа пользователя из контекста и всех его ролей.
+// Администраторы имеют доступ ко всем ключам, запрос без пользователя - ни к одному.
+func (s *Storage) loadACL(ctx context.Context) (*acl, error) {
+	identity := services.IdentityFromContext(ctx)
+	if identity == nil {
+		return &acl{}, nil
+	}
+
+	if models.HasRole(identity.Roles, models.RoleAdmin) {
+		return &acl{admin: true}, nil
+	}
+
+	subjects := []string{models.UserSubject(identity.Username)}
+	for _, role := range []string{models.RoleReader, models.RoleWriter} {
+		if models.HasRole(identity.Roles, role) {
+			subjects = append(subjects, models.RoleSubject(role))
+		}
+	}
+
+	grants, err := s.kvStore.ListGrants(ctx, subjects)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить правила доступа: %w", err)
+	}
+
+	return &acl{grants: grants}, nil
+}
+
+func (a *acl) canRead(key string) bool {
+	return a.allowed(key, func(g *models.Grant) bool { return g.Read })
+}
+
+func (a *acl) canWrite(key string) bool {
+	return a.allowed(key, func(g *models.Grant) bool { return g.Write })
+}
+
+func (a *acl) allowed(key string, perm func(g *models.Grant) bool) bool {
+	if a.admin {
+		return true
+	}
+
+	for _, grant := range a.grants {
+		if perm(grant) && strings.HasPrefix(key, grant.Prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filterKeys делит ключи на разрешенные и запрещенные
+func filterKeys(keys []string, allowed func(key string) bool) ([]string, []string) {
+	ok := make([]string, 0, len(keys))
+	denied := make([]string, 0)
+	for _, key := range keys {
+		if allowed(key) {
+			ok = append(ok, key)
+		} else {
+			denied = append(denied, key)
+		}
+	}
+
+	return ok, denied
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+
+	"vk-intern/internal/models"
+)
+
+func TestACLAllowed(t *testing.T) {
+	user := &acl{grants: []*models.Grant{
+		{Subject: "role:reader", Prefix: "public:", Read: true},
+		{Subject: "user:alice", Prefix: "alice:", Read: true, Write: true},
+		{Subject: "user:alice", Prefix: "drop:", Write: true},
+	}}
+
+	tests := []struct {
+		name      string
+		acl       *acl
+		key       string
+		wantRead  bool
+		wantWrite bool
+	}{
+		{name: "админ", acl: &acl{admin: true}, key: "any", wantRead: true, wantWrite: true},
+		{name: "без правил", acl: &acl{}, key: "public:a", wantRead: false, wantWrite: false},
+		{name: "только чтение", acl: user, key: "public:a", wantRead: true, wantWrite: false},
+		{name: "чтение и запись", acl: user, key: "alice:a", wantRead: true, wantWrite: true},
+		{name: "только запись", acl: user, key: "drop:a", wantRead: false, wantWrite: true},
+		{name: "ключ равен префиксу", acl: user, key: "alice:", wantRead: true, wantWrite: true},
+		{name: "префикс длиннее ключа", acl: user, key: "alice", wantRead: false, wantWrite: false},
+		{name: "чужой префикс", acl: user, key: "bob:a", wantRead: false, wantWrite: false},
+		{
+			name:     "пустой префикс",
+			acl:      &acl{grants: []*models.Grant{{Prefix: "", Read: true}}},
+			key:      "anything",
+			wantRead: true,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.acl.canRead(tt.key); got != tt.wantRead {
+			t.Errorf("%s: canRead(%q) = %v, want %v", tt.name, tt.key, got, tt.wantRead)
+		}
+		if got := tt.acl.canWrite(tt.key); got != tt.wantWrite {
+			t.Errorf("%s: canWrite(%q) = %v, want %v", tt.name, tt.key, got, tt.wantWrite)
+		}
+	}
+}
+
+func TestFilterKeys(t *testing.T) {
+	a := &acl{grants: []*models.Grant{{Prefix: "a:", Read: true}}}
+
+	ok, denied := filterKeys([]string{"a:1", "b:1", "a:2"}, a.canRead)
+	if want := []string{"a:1", "a:2"}; !slices.Equal(ok, want) {
+		t.Errorf("разрешены %v, want %v", ok, want)
+	}
+	if want := []string{"b:1"}; !slices.Equal(denied, want) {
+		t.Errorf("запрещены %v, want %v", denied, want)
+	}
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+
+	"vk-intern/internal/kvstore"
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
+)
+
+// Сколько раз повторять применение патча, если ключ изменился между чтением и записью
+const patchRetries = 10
+
+// Patch применяет к значению ключа JSON Merge Patch (RFC 7386) или JSON Patch (RFC 6902).
+// Патч применяется к последней версии значения и записывается только при совпадении
+// версии, иначе значение перечитывается. Время жизни ключа сохраняется.
+// Если expected не 0, патч применяется только к этой версии без повторов,
+// а при несовпадении возвращается ErrConflict.
+// Если maxSize не 0 и JSON-представление результата длиннее maxSize байт,
+// значение не записывается и возвращается ErrValueTooLarge.
+func (s *Storage) Patch(ctx context.Context, timeout time.Duration,
+	key, patchType string, patch []byte, expected uint64, maxSize int,
+) (*models.Pair, error) {
+	const op = "service.Patch"
+	log := s.log.With(slog.String("op", op), slog.String("key", key))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	acl, err := s.loadACL(ctx)
+	if err != nil {
+		log.Error("Ошибка при проверке доступа",
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	if !acl.canRead(key) || !acl.canWrite(key) {
+		log.Error("Нет доступа к ключу")
+		return nil, fmt.Errorf("%s: %w", op, services.ErrAccessDenied)
+	}
+
+	apply, err := patchFunc(patchType, patch)
+	if err != nil {
+		log.Error("Некорректный патч", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, services.ErrBadPatch)
+	}
+
+	for range patchRetries {
+		pair, err := s.kvStore.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, kvstore.ErrDataNotFound) {
+				log.Info("Ключ не найден")
+				return nil, fmt.Errorf("%s: %w", op, services.ErrNotFound)
+			}
+			log.Error("Ошибка при чтении из базы данных",
+				slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+		}
+
+		if expected != 0 && pair.Version != expected {
+			log.Error("Версия ключа изменилась")
+			return nil, fmt.Errorf("%s: %w", op, services.ErrConflict)
+		}
+
+		value, size, err := patchValue(pair.Value, apply)
+		if err != nil {
+			log.Error("Не удалось применить патч", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%s: %w", op, services.ErrPatchFailed)
+		}
+
+		if maxSize > 0 && size > maxSize {
+			log.Error("Значение после патча превышает допустимый размер", slog.Int("size", size))
+			return nil, fmt.Errorf("%s: %w", op, services.ErrValueTooLarge)
+		}
+
+		ttl := models.TTL{}
+		if pair.ExpiresAt != 0 {
+			// Ключ мог истечь, пока применялся патч: запись с нулевым временем жизни сделала бы его постоянным
+			remaining := time.Until(time.Unix(int64(pair.ExpiresAt), 0))
+			if remaining <= 0 {
+				log.Info("Время жизни ключа истекло")
+				return nil, fmt.Errorf("%s: %w", op, services.ErrNotFound)
+			}
+			ttl[key] = remaining
+		}
+
+		versions, failed, err := s.kvStore.Write(ctx, models.Data{key: value}, ttl, models.Versions{key: pair.Version})
+		if err == nil {
+			err = failed[key]
+		}
+		if errors.Is(err, kvstore.ErrVersionConflict) {
+			if expected != 0 {
+				log.Error("Версия ключа изменилась")
+				return nil, fmt.Errorf("%s: %w", op, services.ErrConflict)
+			}
+			log.Info("Ключ изменился, повтор применения патча")
+			continue
+		}
+		if err != nil {
+			log.Error("Ошибка при записи в базу данных",
+				slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+		}
+		log.Info("Патч применен")
+
+		return &models.Pair{Key: key, Value: value, ExpiresAt: pair.ExpiresAt, Version: versions[key]}, nil
+	}
+
+	log.Error("Ключ слишком часто изменяется, патч не применен")
+	return nil, fmt.Errorf("%s: %w", op, services.ErrConflict)
+}
+
+// patchFunc разбирает патч и возвращает функцию его применения к JSON-документу
+func patchFunc(patchType string, patch []byte) (func(doc []byte) ([]byte, error), error) {
+	switch patchType {
+	case models.PatchTypeMerge:
+		if !json.Valid(patch) {
+			return nil, jsonpatch.ErrBadJSONPatch
+		}
+		return func(doc []byte) ([]byte, error) {
+			// Merge Patch к значению null применяется к пустому объекту, как в RFC 7386
+			if string(doc) == "null" {
+				doc = []byte("{}")
+			}
+			return jsonpatch.MergePatch(doc, patch)
+		}, nil
+	case models.PatchTypeJSON:
+		decoded, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, err
+		}
+		return decoded.Apply, nil
+	default:
+		return nil, fmt.Errorf("неизвестный тип патча: %s", patchType)
+	}
+}
+
+// patchValue применяет патч к значению и возвращает результат
+// и размер его JSON-представления в байтах
+func patchValue(value any, apply func(doc []byte) ([]byte, error)) (any, int, error) {
+	doc, err := json.Marshal(value)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	patched, err := apply(doc)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var result any
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return nil, 0, err
+	}
+
+	// Размер считается так же, как при проверке значений в запросах записи
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return result, len(encoded), nil
+}
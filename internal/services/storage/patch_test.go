@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"vk-intern/internal/kvstore/memory"
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
+)
+
+func TestPatchValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     any
+		patchType string
+		patch     string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name: "merge patch объекта", value: map[string]any{"a": 1.0, "b": 2.0},
+			patchType: models.PatchTypeMerge, patch: `{"b": null, "c": {"d": 3}}`,
+			want: `{"a":1,"c":{"d":3}}`,
+		},
+		{
+			name: "merge patch к null применяется к пустому объекту", value: nil,
+			patchType: models.PatchTypeMerge, patch: `{"a": 1}`,
+			want: `{"a":1}`,
+		},
+		{
+			name: "merge patch не объектом заменяет значение", value: map[string]any{"a": 1.0},
+			patchType: models.PatchTypeMerge, patch: `[1, 2]`,
+			want: `[1,2]`,
+		},
+		{
+			name: "json patch объекта", value: map[string]any{"a": []any{1.0}},
+			patchType: models.PatchTypeJSON, patch: `[{"op": "add", "path": "/a/-", "value": 2}, {"op": "remove", "path": "/a/0"}]`,
+			want: `{"a":[2]}`,
+		},
+		{
+			name: "json patch массива", value: []any{1.0, 2.0},
+			patchType: models.PatchTypeJSON, patch: `[{"op": "replace", "path": "/0", "value": {"a": 1}}]`,
+			want: `[{"a":1},2]`,
+		},
+		{
+			name: "json patch к null не подменяет значение объектом", value: nil,
+			patchType: models.PatchTypeJSON, patch: `[{"op": "add", "path": "/a", "value": 1}]`,
+			wantErr: true,
+		},
+		{
+			name: "не выполнена проверка test", value: map[string]any{"a": 1.0},
+			patchType: models.PatchTypeJSON, patch: `[{"op": "test", "path": "/a", "value": 2}]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		apply, err := patchFunc(tt.patchType, []byte(tt.patch))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		got, size, err := patchValue(tt.value, apply)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: результат %v, want ошибку", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if encoded := mustJSON(t, got); encoded != tt.want || size != len(tt.want) {
+			t.Errorf("%s: %s размером %d, want %s размером %d", tt.name, encoded, size, tt.want, len(tt.want))
+		}
+	}
+}
+
+func TestPatchFuncInvalid(t *testing.T) {
+	tests := []struct {
+		patchType string
+		patch     string
+	}{
+		{patchType: models.PatchTypeMerge, patch: `{"a": `},
+		{patchType: models.PatchTypeJSON, patch: `{"op": "add"}`},
+		{patchType: "text/plain", patch: `{}`},
+	}
+
+	for _, tt := range tests {
+		if _, err := patchFunc(tt.patchType, []byte(tt.patch)); err == nil {
+			t.Errorf("%s %s: патч принят", tt.patchType, tt.patch)
+		}
+	}
+}
+
+// racingStore - хранилище, в котором ключ изменяется другим клиентом
+// между чтением и первой записью патча
+type racingStore struct {
+	*memory.Memory
+	once       sync.Once
+	writes     int
+	concurrent models.Data
+	// Если не 0, Get возвращает это время истечения, как будто ключ истекает во время патча
+	expiresAt uint64
+}
+
+func (s *racingStore) Get(ctx context.Context, key string) (*models.Pair, error) {
+	pair, err := s.Memory.Get(ctx, key)
+	if err == nil && s.expiresAt != 0 {
+		pair.ExpiresAt = s.expiresAt
+	}
+	return pair, err
+}
+
+func (s *racingStore) Write(ctx context.Context,
+	data models.Data, ttl models.TTL, expected models.Versions,
+) (models.Versions, map[string]error, error) {
+	s.once.Do(func() {
+		if _, _, err := s.Memory.Write(ctx, s.concurrent, models.TTL{"k": time.Hour}, nil); err != nil {
+			panic(err)
+		}
+	})
+	s.writes++
+	return s.Memory.Write(ctx, data, ttl, expected)
+}
+
+func newPatchStorage(t *testing.T, value any, concurrent any) (*Storage, *racingStore, context.Context) {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := memory.New(log)
+	t.Cleanup(m.Stop)
+
+	ctx := services.WithIdentity(context.Background(),
+		&services.Identity{Username: "admin", Roles: []string{models.RoleAdmin}})
+	if _, _, err := m.Write(ctx, models.Data{"k": value}, models.TTL{"k": time.Hour}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &racingStore{Memory: m, concurrent: models.Data{"k": concurrent}}
+	return New(log, store), store, ctx
+}
+
+func TestPatchRetry(t *testing.T) {
+	s, store, ctx := newPatchStorage(t, map[string]any{"a": 1.0}, map[string]any{"a": 1.0, "b": 2.0})
+
+	pair, err := s.Patch(ctx, time.Second, "k", models.PatchTypeMerge, []byte(`{"c": 3}`), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Первая запись не прошла проверку версии, патч применен к значению другого клиента
+	if got := mustJSON(t, pair.Value); got != `{"a":1,"b":2,"c":3}` || store.writes != 2 {
+		t.Errorf("значение %s после %d записей, want {\"a\":1,\"b\":2,\"c\":3} после 2", got, store.writes)
+	}
+	if pair.ExpiresAt == 0 {
+		t.Error("патч сделал ключ бессрочным")
+	}
+}
+
+func TestPatchExpectedVersion(t *testing.T) {
+	s, store, ctx := newPatchStorage(t, map[string]any{"a": 1.0}, map[string]any{"a": 2.0})
+
+	current, err := store.Memory.Get(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// С ожидаемой версией патч не повторяется
+	_, err = s.Patch(ctx, time.Second, "k", models.PatchTypeMerge, []byte(`{"c": 3}`), current.Version, 0)
+	if !errors.Is(err, services.ErrConflict) || store.writes != 1 {
+		t.Errorf("ошибка %v после %d записей, want %v после 1", err, store.writes, services.ErrConflict)
+	}
+
+	_, err = s.Patch(ctx, time.Second, "k", models.PatchTypeMerge, []byte(`{"c": 3}`), current.Version, 0)
+	if !errors.Is(err, services.ErrConflict) {
+		t.Errorf("устаревшая версия: ошибка %v, want %v", err, services.ErrConflict)
+	}
+}
+
+func TestPatchExpired(t *testing.T) {
+	s, store, ctx := newPatchStorage(t, map[string]any{"a": 1.0}, nil)
+	store.once.Do(func() {})
+	store.expiresAt = uint64(time.Now().Add(-time.Second).Unix())
+
+	// Ключ, истекший во время патча, не записывается заново без времени жизни
+	_, err := s.Patch(ctx, time.Second, "k", models.PatchTypeMerge, []byte(`{"c": 3}`), 0, 0)
+	if !errors.Is(err, services.ErrNotFound) || store.writes != 0 {
+		t.Errorf("ошибка %v после %d записей, want %v без записи", err, store.writes, services.ErrNotFound)
+	}
+}
+
+func TestPatchValueTooLarge(t *testing.T) {
+	s, store, ctx := newPatchStorage(t, map[string]any{"a": 1.0}, nil)
+	store.once.Do(func() {})
+
+	_, err := s.Patch(ctx, time.Second, "k", models.PatchTypeMerge, []byte(`{"b": "0123456789"}`), 0, 16)
+	if !errors.Is(err, services.ErrValueTooLarge) || store.writes != 0 {
+		t.Errorf("ошибка %v после %d записей, want %v без записи", err, store.writes, services.ErrValueTooLarge)
+	}
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -2,17 +2,29 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
+	"vk-intern/internal/kvstore"
 	"vk-intern/internal/models"
 	"vk-intern/internal/services"
 )
 
 type KVStore interface {
-	Write(ctx context.Context, data models.Data) error
-	Read(ctx context.Context, keys []string) (models.Data, error)
+	Write(ctx context.Context, data models.Data, ttl models.TTL, expected models.Versions) (models.Versions, map[string]error, error)
+	WriteAtomic(ctx context.Context, data models.Data, ttl models.TTL, expected models.Versions) (models.Versions, error)
+	Read(ctx context.Context, keys []string) (models.Data, models.Versions, []string, error)
+	Get(ctx context.Context, key string) (*models.Pair, error)
+	Scan(ctx context.Context, prefix, after string, limit int) ([]*models.Pair, string, error)
+	Delete(ctx context.Context, keys []string) ([]string, error)
+	DeleteVersion(ctx context.Context, key string, expected uint64) (bool, error)
+	Incr(ctx context.Context, deltas map[string]float64) (map[string]float64, models.Versions, error)
+	Subscribe(ctx context.Context) (<-chan *models.Event, error)
+
+	ListGrants(ctx context.Context, subjects []string) ([]*models.Grant, error)
 }
 
 type Storage struct {
@@ -27,43 +39,347 @@ func New(log *slog.Logger, kvStore KVStore) *Storage {
 	}
 }
 
-func (s *Storage) Write(ctx context.Context,
-	timeout time.Duration, data models.Data,
-) error {
+// Write записывает пары, к которым у пользователя есть доступ на запись.
+// Ключи без доступа не записываются и возвращаются отдельно.
+// Ошибка записи одного ключа не прерывает запись остальных, такие ключи
+// возвращаются с ошибкой ErrConflict или ErrInternal.
+func (s *Storage) Write(ctx context.Context, timeout time.Duration,
+	data models.Data, ttl models.TTL, expected models.Versions,
+) (models.Versions, map[string]error, []string, error) {
 	const op = "service.Write"
 	log := s.log.With(slog.String("op", op))
 
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	allowed, denied, err := s.filterWrite(ctx, data)
+	if err != nil {
+		log.Error("Ошибка при проверке доступа",
+			slog.String("error", err.Error()))
+		return nil, nil, nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	if len(allowed) == 0 {
+		log.Info("Нет ключей, доступных для записи")
+		return models.Versions{}, map[string]error{}, denied, nil
+	}
+
 	log.Info("Запись в базу данных")
-	if err := s.kvStore.Write(ctx, data); err != nil {
+	versions, failed, err := s.kvStore.Write(ctx, allowed, ttl, expected)
+	if err != nil {
 		log.Error("Ошибка при записи в базу данных",
 			slog.String("error", err.Error()))
-		return fmt.Errorf("%s: %w", op, services.ErrInternal)
+		return nil, nil, nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
 	}
-	log.Info("Запись прошла успешно")
 
-	return nil
+	errs := make(map[string]error, len(failed))
+	for key, err := range failed {
+		log.Error("Ошибка при записи ключа",
+			slog.String("key", key), slog.String("error", err.Error()))
+		if errors.Is(err, kvstore.ErrVersionConflict) {
+			errs[key] = services.ErrConflict
+		} else {
+			errs[key] = services.ErrInternal
+		}
+	}
+	log.Info("Запись завершена", slog.Int("written", len(versions)), slog.Int("failed", len(errs)))
+
+	return versions, errs, denied, nil
 }
 
+// WriteAtomic записывает все пары в одной транзакции.
+// Если хотя бы к одному ключу нет доступа, ничего не записывается.
+func (s *Storage) WriteAtomic(ctx context.Context, timeout time.Duration,
+	data models.Data, ttl models.TTL, expected models.Versions,
+) (models.Versions, []string, error) {
+	const op = "service.WriteAtomic"
+	log := s.log.With(slog.String("op", op))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, denied, err := s.filterWrite(ctx, data)
+	if err != nil {
+		log.Error("Ошибка при проверке доступа",
+			slog.String("error", err.Error()))
+		return nil, nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	if len(denied) != 0 {
+		log.Error("Нет доступа к части ключей", slog.Any("denied", denied))
+		return nil, denied, fmt.Errorf("%s: %w: %w", op, services.ErrRolledBack, services.ErrAccessDenied)
+	}
+
+	log.Info("Атомарная запись в базу данных")
+	versions, err := s.kvStore.WriteAtomic(ctx, data, ttl, expected)
+	if err != nil {
+		log.Error("Ошибка при атомарной записи в базу данных",
+			slog.String("error", err.Error()))
+		if errors.Is(err, kvstore.ErrVersionConflict) {
+			return nil, nil, fmt.Errorf("%s: %w: %w", op, services.ErrRolledBack, services.ErrConflict)
+		}
+		if errors.Is(err, kvstore.ErrRolledBack) {
+			return nil, nil, fmt.Errorf("%s: %w", op, services.ErrRolledBack)
+		}
+		return nil, nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+	log.Info("Атомарная запись прошла успешно")
+
+	return versions, nil, nil
+}
+
+func (s *Storage) filterWrite(ctx context.Context, data models.Data) (models.Data, []string, error) {
+	acl, err := s.loadACL(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	allowed := make(models.Data, len(data))
+	denied := make([]string, 0)
+	for k, v := range data {
+		if acl.canWrite(k) {
+			allowed[k] = v
+		} else {
+			denied = append(denied, k)
+		}
+	}
+	slices.Sort(denied)
+
+	return allowed, denied, nil
+}
+
+// Incr атомарно увеличивает значения ключей, к которым у пользователя есть доступ на запись.
+// Ключи без доступа не изменяются и возвращаются отдельно.
+func (s *Storage) Incr(ctx context.Context, timeout time.Duration,
+	deltas map[string]float64,
+) (map[string]float64, models.Versions, []string, error) {
+	const op = "service.Incr"
+	log := s.log.With(slog.String("op", op))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	acl, err := s.loadACL(ctx)
+	if err != nil {
+		log.Error("Ошибка при проверке доступа",
+			slog.String("error", err.Error()))
+		return nil, nil, nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	allowed := make(map[string]float64, len(deltas))
+	denied := make([]string, 0)
+	for k, delta := range deltas {
+		if acl.canWrite(k) {
+			allowed[k] = delta
+		} else {
+			denied = append(denied, k)
+		}
+	}
+	slices.Sort(denied)
+
+	if len(allowed) == 0 {
+		log.Info("Нет ключей, доступных для изменения")
+		return map[string]float64{}, models.Versions{}, denied, nil
+	}
+
+	log.Info("Увеличение значений ключей")
+	values, versions, err := s.kvStore.Incr(ctx, allowed)
+	if err != nil {
+		log.Error("Ошибка при увеличении значений",
+			slog.String("error", err.Error()))
+		if errors.Is(err, kvstore.ErrNotNumeric) {
+			return nil, nil, nil, fmt.Errorf("%s: %w", op, services.ErrNotNumeric)
+		}
+		return nil, nil, nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+	log.Info("Значения ключей увеличены")
+
+	return values, versions, denied, nil
+}
+
+// Read читает ключи, к которым у пользователя есть доступ на чтение.
+// Третьим значением возвращаются отсутствующие ключи, четвертым - ключи без доступа.
 func (s *Storage) Read(ctx context.Context,
 	timeout time.Duration, keys []string,
-) (models.Data, error) {
+) (models.Data, models.Versions, []string, []string, error) {
 	const op = "service.Read"
 	log := s.log.With(slog.String("op", op))
 
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	acl, err := s.loadACL(ctx)
+	if err != nil {
+		log.Error("Ошибка при проверке доступа",
+			slog.String("error", err.Error()))
+		return nil, nil, nil, nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	allowed, denied := filterKeys(keys, acl.canRead)
+	if len(allowed) == 0 {
+		log.Info("Нет ключей, доступных для чтения")
+		return models.Data{}, models.Versions{}, []string{}, denied, nil
+	}
+
 	log.Info("Чтение базы данных")
-	data, err := s.kvStore.Read(ctx, keys)
+	data, versions, missing, err := s.kvStore.Read(ctx, allowed)
+	if err != nil {
+		log.Error("Ошибка при чтении из базы данных",
+			slog.String("error", err.Error()))
+		return nil, nil, nil, nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+	log.Info("Чтение прошло успешно")
+
+	return data, versions, missing, denied, nil
+}
+
+// Get читает один ключ. Для отсутствующего или истекшего ключа возвращается ErrNotFound
+func (s *Storage) Get(ctx context.Context, timeout time.Duration, key string) (*models.Pair, error) {
+	const op = "service.Get"
+	log := s.log.With(slog.String("op", op), slog.String("key", key))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	acl, err := s.loadACL(ctx)
+	if err != nil {
+		log.Error("Ошибка при проверке доступа",
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	if !acl.canRead(key) {
+		log.Error("Нет доступа к ключу")
+		return nil, fmt.Errorf("%s: %w", op, services.ErrAccessDenied)
+	}
+
+	log.Info("Чтение ключа из базы данных")
+	pair, err := s.kvStore.Get(ctx, key)
 	if err != nil {
+		if errors.Is(err, kvstore.ErrDataNotFound) {
+			log.Info("Ключ не найден")
+			return nil, fmt.Errorf("%s: %w", op, services.ErrNotFound)
+		}
 		log.Error("Ошибка при чтении из базы данных",
 			slog.String("error", err.Error()))
 		return nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
 	}
 	log.Info("Чтение прошло успешно")
 
-	return data, nil
+	return pair, nil
+}
+
+// Scan возвращает только ключи, к которым у пользователя есть доступ на чтение
+func (s *Storage) Scan(ctx context.Context, timeout time.Duration,
+	prefix, after string, limit int,
+) ([]*models.Pair, string, error) {
+	const op = "service.Scan"
+	log := s.log.With(slog.String("op", op))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	acl, err := s.loadACL(ctx)
+	if err != nil {
+		log.Error("Ошибка при проверке доступа",
+			slog.String("error", err.Error()))
+		return nil, "", fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	log.Info("Поиск ключей по префиксу")
+	pairs, next, err := s.kvStore.Scan(ctx, prefix, after, limit)
+	if err != nil {
+		log.Error("Ошибка при поиске ключей",
+			slog.String("error", err.Error()))
+		return nil, "", fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+	log.Info("Поиск прошел успешно")
+
+	allowed := make([]*models.Pair, 0, len(pairs))
+	for _, pair := range pairs {
+		if acl.canRead(pair.Key) {
+			allowed = append(allowed, pair)
+		}
+	}
+
+	return allowed, next, nil
+}
+
+// Delete удаляет ключи, к которым у пользователя есть доступ на запись.
+// Ключи без доступа не удаляются и возвращаются отдельно.
+func (s *Storage) Delete(ctx context.Context,
+	timeout time.Duration, keys []string,
+) ([]string, []string, error) {
+	const op = "service.Delete"
+	log := s.log.With(slog.String("op", op))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	acl, err := s.loadACL(ctx)
+	if err != nil {
+		log.Error("Ошибка при проверке доступа",
+			slog.String("error", err.Error()))
+		return nil, nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	allowed, denied := filterKeys(keys, acl.canWrite)
+	if len(allowed) == 0 {
+		log.Info("Нет ключей, доступных для удаления")
+		return []string{}, denied, nil
+	}
+
+	log.Info("Удаление из базы данных")
+	deleted, err := s.kvStore.Delete(ctx, allowed)
+	if err != nil {
+		log.Error("Ошибка при удалении из базы данных",
+			slog.String("error", err.Error()))
+		return nil, nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+	log.Info("Удаление прошло успешно")
+
+	return deleted, denied, nil
+}
+
+// DeleteVersion удаляет ключ, только если его текущая версия равна expected.
+// Если версия изменилась, возвращается ErrConflict, если ключа нет - ErrNotFound.
+func (s *Storage) DeleteVersion(ctx context.Context,
+	timeout time.Duration, key string, expected uint64,
+) error {
+	const op = "service.DeleteVersion"
+	log := s.log.With(slog.String("op", op), slog.String("key", key))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	acl, err := s.loadACL(ctx)
+	if err != nil {
+		log.Error("Ошибка при проверке доступа",
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	if !acl.canWrite(key) {
+		log.Error("Нет доступа к ключу")
+		return fmt.Errorf("%s: %w", op, services.ErrAccessDenied)
+	}
+
+	log.Info("Удаление из базы данных с проверкой версии")
+	deleted, err := s.kvStore.DeleteVersion(ctx, key, expected)
+	if err != nil {
+		log.Error("Ошибка при удалении из базы данных",
+			slog.String("error", err.Error()))
+		if errors.Is(err, kvstore.ErrVersionConflict) {
+			return fmt.Errorf("%s: %w", op, services.ErrConflict)
+		}
+		return fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	if !deleted {
+		log.Info("Ключ не найден")
+		return fmt.Errorf("%s: %w", op, services.ErrNotFound)
+	}
+	log.Info("Удаление прошло успешно")
+
+	return nil
 }
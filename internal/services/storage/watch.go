@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"vk-intern/internal/models"
+	"vk-intern/internal/services"
+)
+
+// Watch возвращает канал изменений ключей keys или, если keys пуст, ключей с префиксом prefix.
+// В канал попадают только ключи, к которым у пользователя есть доступ на чтение
+// на момент подписки. Канал закрывается после завершения ctx.
+func (s *Storage) Watch(ctx context.Context, keys []string, prefix string) (<-chan *models.Event, error) {
+	const op = "service.Watch"
+	log := s.log.With(slog.String("op", op))
+
+	acl, err := s.loadACL(ctx)
+	if err != nil {
+		log.Error("Ошибка при проверке доступа",
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	log.Info("Подписка на изменения ключей")
+	events, err := s.kvStore.Subscribe(ctx)
+	if err != nil {
+		log.Error("Ошибка при подписке на изменения",
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, services.ErrInternal)
+	}
+
+	watched := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		watched[key] = struct{}{}
+	}
+
+	match := func(key string) bool {
+		if len(watched) != 0 {
+			_, ok := watched[key]
+			return ok
+		}
+		return strings.HasPrefix(key, prefix)
+	}
+
+	out := make(chan *models.Event)
+	go func() {
+		defer close(out)
+		for event := range events {
+			if !match(event.Key) || !acl.canRead(event.Key) {
+				continue
+			}
+
+			select {
+			case out <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
@@ -1,5 +1,6 @@
 -- Подключение и создание БД, если не существует
-box.cfg({ listen = 3301 })
+-- MVCC нужен для интерактивных транзакций в потоках (атомарная запись)
+box.cfg({ listen = 3301, memtx_use_mvcc_engine = true })
 box.schema.user.create("storage", { password = "admin", if_not_exists = true })
 box.schema.user.grant("storage", "super", nil, nil, { if_not_exists = true })
 
@@ -8,24 +9,410 @@ local kv_storage = box.schema.space.create("kv_storage", { if_not_exists = true
 kv_storage:format({
 	{ name = "key", type = "string" },
 	{ name = "value", type = "any" },
+	-- unix-время истечения в секундах, null - бессрочно
+	{ name = "expires_at", type = "unsigned", is_nullable = true },
+	-- Версия ключа, увеличивается при каждой записи
+	{ name = "version", type = "unsigned", is_nullable = true },
 })
 kv_storage:create_index("primary", {
 	if_not_exists = true,
 	parts = { "key" },
 })
+-- В индекс попадают только ключи со сроком жизни
+kv_storage:create_index("expires", {
+	if_not_exists = true,
+	unique = false,
+	parts = { { field = "expires_at", type = "unsigned", is_nullable = true, exclude_null = true } },
+})
+
+-- Ключи, записанные до появления сроков жизни и версий, дополняются
+-- пустым expires_at и версией 1, иначе кортеж не читается приложением
+local without_version = {}
+for _, t in kv_storage:pairs() do
+	if t.version == nil then
+		table.insert(without_version, t)
+	end
+end
+for _, t in ipairs(without_version) do
+	local expires_at = t.expires_at
+	if expires_at == nil then
+		expires_at = box.NULL
+	end
+	kv_storage:replace({ t.key, t.value, expires_at, 1 })
+end
+
+-- Версии ключей берутся из общей последовательности, поэтому версия ключа
+-- только растет, даже если ключ удалили или он истек и был создан заново.
+-- При создании последовательность начинается после наибольшей версии в kv_storage.
+local versions_created = box.sequence.kv_versions == nil
+local kv_versions = box.schema.sequence.create("kv_versions", { if_not_exists = true })
+if versions_created then
+	local max_version = 0
+	for _, t in kv_storage:pairs() do
+		if t.version ~= nil and t.version > max_version then
+			max_version = t.version
+		end
+	end
+	if max_version > 0 then
+		kv_versions:set(max_version)
+	end
+end
+
+-- Запись пары с новой версией ключа.
+-- Если передана ожидаемая версия expected, запись выполняется только при совпадении
+-- с текущей версией (0 - ключ не существует). Возвращает новую или текущую версию
+-- и признак конфликта.
+function kv_put(key, value, expires_at, expected)
+	local now = math.floor(require("clock").time())
+	local old = box.space.kv_storage:get({ key })
+
+	-- Истекший ключ считается отсутствующим
+	local current = 0
+	if old ~= nil and old.version ~= nil and (old.expires_at == nil or old.expires_at > now) then
+		current = old.version
+	end
+
+	if expected ~= nil and expected ~= current then
+		return current, true
+	end
+
+	if expires_at == nil then
+		expires_at = box.NULL
+	end
+	local version = box.sequence.kv_versions:next()
+	box.space.kv_storage:replace({ key, value, expires_at, version })
+	return version, false
+end
+box.schema.func.create("kv_put", { if_not_exists = true })
+
+-- Удаление ключа, если его текущая версия совпадает с expected.
+-- Возвращает признак удаления и признак конфликта версий.
+function kv_delete(key, expected)
+	local now = math.floor(require("clock").time())
+	local old = box.space.kv_storage:get({ key })
+
+	local current = 0
+	if old ~= nil and old.version ~= nil and (old.expires_at == nil or old.expires_at > now) then
+		current = old.version
+	end
+
+	if current ~= expected then
+		return false, true
+	end
+	if current == 0 then
+		return false, false
+	end
+
+	box.space.kv_storage:delete({ key })
+	return true, false
+end
+box.schema.func.create("kv_delete", { if_not_exists = true })
+
+-- Атомарное увеличение числовых значений ключей. deltas - ключ и приращение.
+-- Существующие значения меняются операцией update "+", отсутствующие и истекшие
+-- ключи создаются со значением приращения. Если значение хотя бы одного ключа
+-- не число, ничего не меняется и возвращается этот ключ.
+function kv_incr(deltas)
+	local now = math.floor(require("clock").time())
+	local space = box.space.kv_storage
+
+	local alive = {}
+	for key in pairs(deltas) do
+		local t = space:get({ key })
+		if t ~= nil and (t.expires_at == nil or t.expires_at > now) then
+			local kind = type(t.value)
+			if kind ~= "number" and not (kind == "cdata" and tonumber(t.value) ~= nil) then
+				return box.NULL, box.NULL, key
+			end
+			alive[key] = true
+		end
+	end
+
+	local values = setmetatable({}, { __serialize = "map" })
+	local versions = setmetatable({}, { __serialize = "map" })
+	box.atomic(function()
+		for key, delta in pairs(deltas) do
+			local version = box.sequence.kv_versions:next()
+
+			local t
+			if alive[key] then
+				t = space:update({ key }, { { "+", "value", delta }, { "=", "version", version } })
+			else
+				t = space:replace({ key, delta, box.NULL, version })
+			end
+			values[key] = t.value
+			versions[key] = t.version
+		end
+	end)
+	return values, versions, box.NULL
+end
+box.schema.func.create("kv_incr", { if_not_exists = true })
+
+-- Журнал изменений kv_storage для api/watch. Записи добавляет триггер on_replace,
+-- после фиксации транзакции номер последней записи рассылается через box.broadcast,
+-- а приложение дочитывает новые записи по первичному индексу.
+-- Записи хранятся CHANGES_TTL секунд.
+local CHANGES_TTL = 60
+
+local kv_changes = box.schema.space.create("kv_changes", { if_not_exists = true })
+kv_changes:format({
+	{ name = "id", type = "unsigned" },
+	{ name = "key", type = "string" },
+	{ name = "value", type = "any", is_nullable = true },
+	{ name = "version", type = "unsigned" },
+	-- put или delete
+	{ name = "op", type = "string" },
+	{ name = "expires_at", type = "unsigned" },
+})
+box.schema.sequence.create("kv_changes_seq", { if_not_exists = true })
+kv_changes:create_index("primary", {
+	if_not_exists = true,
+	parts = { "id" },
+	sequence = "kv_changes_seq",
+})
+kv_changes:create_index("expires", {
+	if_not_exists = true,
+	unique = false,
+	parts = { "expires_at" },
+})
+
+kv_storage:on_replace(function(old, new)
+	local now = math.floor(require("clock").time())
+	local change
+	if new ~= nil then
+		change = { box.NULL, new.key, new.value, new.version or 0, "put", now + CHANGES_TTL }
+	else
+		change = { box.NULL, old.key, box.NULL, old.version or 0, "delete", now + CHANGES_TTL }
+	end
+
+	local id = box.space.kv_changes:insert(change).id
+	box.on_commit(function()
+		box.broadcast("kv_changes", id)
+	end)
+end)
 
 -- Создание таблицы пользователей
 local kv_users = box.schema.space.create("kv_users", { if_not_exists = true })
 kv_users:format({
 	{ name = "username", type = "string" },
+	-- bcrypt-хеш пароля. Старые пароли открытым текстом заменяются хешем при входе
 	{ name = "password", type = "string" },
+	-- Роли пользователя: reader, writer или admin
+	{ name = "roles", type = "array", is_nullable = true },
 })
 kv_users:create_index("primary", {
 	if_not_exists = true,
 	parts = { "username" },
 })
 
--- Создаем пользователя, если не существует
+-- Создаем пользователя, если не существует (пароль presale)
 if #kv_users:select({ "admin" }) == 0 then
-	kv_users:insert({ "admin", "presale" })
+	kv_users:insert({ "admin", "$2a$10$UAmBy5uEOjJ1Ci52C3N5xOLS6eYfYmLdaDM.l9QjyrET/aIwIWkGC", { "admin" } })
+end
+
+-- Пользователи, созданные до появления ролей, сохраняют прежний доступ на запись
+local without_roles = {}
+for _, user in kv_users:pairs() do
+	if user.roles == nil then
+		table.insert(without_roles, user.username)
+	end
+end
+for _, username in ipairs(without_roles) do
+	local roles = { "writer" }
+	if username == "admin" then
+		roles = { "admin" }
+	end
+	kv_users:update({ username }, { { "=", "roles", roles } })
+end
+
+-- Создание таблицы правил доступа к префиксам ключей.
+-- subject - user:<имя> или role:<роль>, права роли получают и старшие роли
+local acl_created = box.space.kv_acl == nil
+local kv_acl = box.schema.space.create("kv_acl", { if_not_exists = true })
+kv_acl:format({
+	{ name = "subject", type = "string" },
+	{ name = "prefix", type = "string" },
+	{ name = "read", type = "boolean" },
+	{ name = "write", type = "boolean" },
+})
+kv_acl:create_index("primary", {
+	if_not_exists = true,
+	parts = { "subject", "prefix" },
+})
+
+-- По умолчанию роли имеют доступ ко всем ключам, как до появления правил
+if acl_created then
+	kv_acl:insert({ "role:reader", "", true, false })
+	kv_acl:insert({ "role:writer", "", true, true })
+end
+
+-- Создание таблицы API-ключей. Хранится только SHA-256 хеш ключа
+local kv_api_keys = box.schema.space.create("kv_api_keys", { if_not_exists = true })
+kv_api_keys:format({
+	{ name = "id", type = "string" },
+	{ name = "username", type = "string" },
+	{ name = "hash", type = "string" },
+	{ name = "name", type = "string" },
+	-- Роли, доступные по ключу
+	{ name = "roles", type = "array" },
+	{ name = "created_at", type = "unsigned" },
+	-- unix-время последнего использования, 0 - ключ не использовался
+	{ name = "last_used", type = "unsigned" },
+})
+kv_api_keys:create_index("primary", {
+	if_not_exists = true,
+	parts = { "id" },
+})
+kv_api_keys:create_index("username", {
+	if_not_exists = true,
+	unique = false,
+	parts = { "username" },
+})
+
+-- Удаление пользователя вместе с его API-ключами и правилами доступа user:<имя>
+-- в одной транзакции. Возвращает false, если пользователя нет.
+function kv_delete_user(username)
+	if box.space.kv_users:get({ username }) == nil then
+		return false
+	end
+
+	local subject = "user:" .. username
+	local keys, grants = {}, {}
+	for _, key in box.space.kv_api_keys.index.username:pairs({ username }) do
+		table.insert(keys, key.id)
+	end
+	for _, grant in box.space.kv_acl:pairs({ subject }) do
+		table.insert(grants, grant.prefix)
+	end
+
+	box.atomic(function()
+		box.space.kv_users:delete({ username })
+		for _, id in ipairs(keys) do
+			box.space.kv_api_keys:delete({ id })
+		end
+		for _, prefix in ipairs(grants) do
+			box.space.kv_acl:delete({ subject, prefix })
+		end
+	end)
+	return true
 end
+box.schema.func.create("kv_delete_user", { if_not_exists = true })
+
+-- Создание таблицы неудачных попыток входа.
+-- subject - user:<имя> или ip:<адрес>, запись удаляется после expires_at
+local kv_login_attempts = box.schema.space.create("kv_login_attempts", { if_not_exists = true })
+kv_login_attempts:format({
+	{ name = "subject", type = "string" },
+	{ name = "failures", type = "unsigned" },
+	-- unix-время, до которого вход заблокирован
+	{ name = "locked_until", type = "unsigned" },
+	{ name = "expires_at", type = "unsigned" },
+})
+kv_login_attempts:create_index("primary", {
+	if_not_exists = true,
+	parts = { "subject" },
+})
+kv_login_attempts:create_index("expires", {
+	if_not_exists = true,
+	unique = false,
+	parts = { "expires_at" },
+})
+
+-- Учет неудачной попытки входа. Каждая неудача удваивает задержку
+-- от base_delay до max_delay, после max_failures неудач вход блокируется на lockout.
+-- Счетчик сбрасывается, если за window секунд не было неудач.
+-- Возвращает время, до которого вход заблокирован.
+function kv_login_failed(subject, max_failures, base_delay, max_delay, lockout, window)
+	local now = math.floor(require("clock").time())
+	local old = box.space.kv_login_attempts:get({ subject })
+
+	local failures = 1
+	if old ~= nil and old.expires_at > now then
+		failures = old.failures + 1
+	end
+
+	local locked_until
+	if failures >= max_failures then
+		locked_until = now + lockout
+	else
+		local delay = base_delay
+		for _ = 2, failures do
+			if delay >= max_delay then
+				break
+			end
+			delay = delay * 2
+		end
+		locked_until = now + math.min(delay, max_delay)
+	end
+
+	box.space.kv_login_attempts:replace({ subject, failures, locked_until, math.max(now + window, locked_until) })
+	return locked_until
+end
+box.schema.func.create("kv_login_failed", { if_not_exists = true })
+
+-- Создание таблицы отозванных токенов.
+-- Запись хранится до истечения токена
+local kv_revoked = box.schema.space.create("kv_revoked", { if_not_exists = true })
+kv_revoked:format({
+	{ name = "jti", type = "string" },
+	{ name = "expires_at", type = "unsigned" },
+})
+kv_revoked:create_index("primary", {
+	if_not_exists = true,
+	parts = { "jti" },
+})
+kv_revoked:create_index("expires", {
+	if_not_exists = true,
+	unique = false,
+	parts = { "expires_at" },
+})
+
+-- Фоновое удаление ключей, отозванных токенов, счетчиков входа и журнала изменений с истекшим сроком жизни
+local fiber = require("fiber")
+local clock = require("clock")
+
+local EXPIRY_INTERVAL = 1
+local EXPIRY_BATCH = 1000
+
+-- Удаляет из space до EXPIRY_BATCH кортежей с истекшим expires_at.
+-- В space должен быть индекс expires, первичный ключ - первое поле
+local function expire(space)
+	local now = math.floor(clock.time())
+	local keys = {}
+	for _, t in space.index.expires:pairs({ now }, { iterator = "LE" }) do
+		table.insert(keys, t[1])
+		if #keys >= EXPIRY_BATCH then
+			break
+		end
+	end
+
+	-- Пока удаление ждет записи в WAL, ключ могут перезаписать с новым сроком
+	-- жизни, поэтому срок проверяется заново в той же транзакции
+	for _, key in ipairs(keys) do
+		box.atomic(function()
+			local t = space:get({ key })
+			if t ~= nil and t.expires_at ~= nil and t.expires_at <= now then
+				space:delete({ key })
+			end
+		end)
+	end
+	return #keys
+end
+
+local function expire_all()
+	return math.max(expire(kv_storage), expire(kv_revoked), expire(kv_login_attempts), expire(kv_changes))
+end
+
+fiber.create(function()
+	fiber.name("kv_expiry")
+	while true do
+		local ok, res = pcall(expire_all)
+		if not ok then
+			require("log").error("kv_expiry: " .. tostring(res))
+		end
+		-- Если удалили полный пакет, сразу продолжаем
+		if not ok or res < EXPIRY_BATCH then
+			fiber.sleep(EXPIRY_INTERVAL)
+		end
+	end
+end)